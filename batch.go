@@ -0,0 +1,260 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogmigo
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/statequery"
+)
+
+// Batch queues several state queries so they can be sent together over a
+// single connection.  Each query decodes into the destination provided when
+// it was queued; a Batch should only be sent once.
+//
+//	var (
+//		tip   chainsync.Point
+//		epoch uint64
+//	)
+//	batch := client.NewBatch()
+//	tipReq := batch.ChainTip(&tip)
+//	epochReq := batch.CurrentEpoch(&epoch)
+//	if err := batch.Send(ctx); err != nil {
+//		return err
+//	}
+//	if err := tipReq.Err(); err != nil {
+//		return err
+//	}
+type Batch struct {
+	client   *Client
+	requests []*BatchRequest
+}
+
+// BatchRequest holds the outcome of a single query within a Batch
+type BatchRequest struct {
+	payload Map
+	decode  func(result json.RawMessage) error
+	err     error
+}
+
+// Err returns the error, if any, encountered by this query; only valid once
+// the Batch has been sent
+func (r *BatchRequest) Err() error {
+	return r.err
+}
+
+// NewBatch returns an empty Batch of state queries
+func (c *Client) NewBatch() *Batch {
+	return &Batch{
+		client: c,
+	}
+}
+
+// Len returns the number of queued queries
+func (b *Batch) Len() int {
+	return len(b.requests)
+}
+
+func (b *Batch) add(payload Map, v interface{}) *BatchRequest {
+	return b.addFunc(payload, func(result json.RawMessage) error {
+		return json.Unmarshal(result, v)
+	})
+}
+
+func (b *Batch) addFunc(
+	payload Map,
+	decode func(result json.RawMessage) error,
+) *BatchRequest {
+	r := &BatchRequest{
+		payload: payload,
+		decode:  decode,
+	}
+	b.requests = append(b.requests, r)
+	return r
+}
+
+// ChainTip queues a queryLedgerState/tip query; see Client.ChainTip
+func (b *Batch) ChainTip(point *chainsync.Point) *BatchRequest {
+	return b.add(makePayload("queryLedgerState/tip", Map{}, nil), point)
+}
+
+// CurrentEpoch queues a queryLedgerState/epoch query; see Client.CurrentEpoch
+func (b *Batch) CurrentEpoch(epoch *uint64) *BatchRequest {
+	return b.add(makePayload("queryLedgerState/epoch", Map{}, nil), epoch)
+}
+
+// CurrentProtocolParameters queues a queryLedgerState/protocolParameters
+// query; see Client.CurrentProtocolParameters
+func (b *Batch) CurrentProtocolParameters(
+	params *json.RawMessage,
+) *BatchRequest {
+	return b.add(
+		makePayload("queryLedgerState/protocolParameters", Map{}, nil),
+		params,
+	)
+}
+
+// GenesisConfig queues a queryNetwork/genesisConfiguration query; see
+// Client.GenesisConfig
+func (b *Batch) GenesisConfig(
+	era string,
+	config *json.RawMessage,
+) *BatchRequest {
+	return b.add(
+		makePayload("queryNetwork/genesisConfiguration", Map{"era": era}, nil),
+		config,
+	)
+}
+
+// StartTime queues a queryNetwork/startTime query; see Client.StartTime
+func (b *Batch) StartTime(start *string) *BatchRequest {
+	return b.add(makePayload("queryNetwork/startTime", nil, nil), start)
+}
+
+// BlockHeight queues a queryNetwork/blockHeight query; see Client.BlockHeight
+func (b *Batch) BlockHeight(height *uint64) *BatchRequest {
+	return b.add(makePayload("queryNetwork/blockHeight", nil, nil), height)
+}
+
+// EraSummaries queues a queryLedgerState/eraSummaries query; see
+// Client.EraSummaries
+func (b *Batch) EraSummaries(history *EraHistory) *BatchRequest {
+	return b.add(
+		makePayload("queryLedgerState/eraSummaries", Map{}, nil),
+		&history.Summaries,
+	)
+}
+
+// EraStart queues a queryLedgerState/eraStart query; see Client.EraStart
+func (b *Batch) EraStart(start *statequery.EraStart) *BatchRequest {
+	return b.add(makePayload("queryLedgerState/eraStart", Map{}, nil), start)
+}
+
+// UtxosByAddress queues a queryLedgerState/utxo query by address; see
+// Client.UtxosByAddress
+func (b *Batch) UtxosByAddress(
+	utxos *[]shared.Utxo,
+	addresses ...string,
+) *BatchRequest {
+	return b.add(
+		makePayload("queryLedgerState/utxo", Map{"addresses": addresses}, nil),
+		utxos,
+	)
+}
+
+// UtxosByTxIn queues a queryLedgerState/utxo query by output reference; see
+// Client.UtxosByTxIn
+func (b *Batch) UtxosByTxIn(
+	utxos *[]shared.Utxo,
+	txIns ...chainsync.TxInQuery,
+) *BatchRequest {
+	return b.add(
+		makePayload(
+			"queryLedgerState/utxo",
+			Map{"outputReferences": txIns},
+			nil,
+		),
+		utxos,
+	)
+}
+
+// GetDelegation queues a queryLedgerState/rewardAccountSummaries query for
+// the reward address; see Client.GetDelegation
+func (b *Batch) GetDelegation(
+	rewardAddress string,
+	delegation *Delegation,
+) *BatchRequest {
+	return b.addFunc(
+		makePayload(
+			"queryLedgerState/rewardAccountSummaries",
+			Map{"keys": []string{rewardAddress}},
+			nil,
+		),
+		func(result json.RawMessage) error {
+			rewardAddressVfk, err := rewardAccountKey(rewardAddress)
+			if err != nil {
+				return err
+			}
+			var summaries map[string]*rewardAccountSummary
+			if err := json.Unmarshal(result, &summaries); err != nil {
+				return err
+			}
+			*delegation, err = delegationOf(rewardAddress, rewardAddressVfk, summaries)
+			return err
+		},
+	)
+}
+
+// Send writes every queued query over a single connection and waits for all
+// of the responses.  Failures of individual queries are reported by the
+// corresponding BatchRequest; Send itself only fails if no connection to
+// ogmios could be established.
+func (b *Batch) Send(ctx context.Context) error {
+	if len(b.requests) == 0 {
+		return nil
+	}
+
+	var (
+		conn *rpcConn
+		err  error
+	)
+	for _, e := range b.client.endpoints.order() {
+		if conn, err = e.pool.get(ctx); err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			break // the endpoint is not to blame
+		}
+		b.client.endpoints.failed(e)
+	}
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for _, r := range b.requests {
+		wg.Add(1)
+		go func(r *BatchRequest) {
+			defer wg.Done()
+			r.err = b.client.send(ctx, conn, r)
+		}(r)
+	}
+	wg.Wait()
+
+	return nil
+}
+
+func (c *Client) send(ctx context.Context, conn *rpcConn, r *BatchRequest) error {
+	raw, err := c.intercept(ctx, c.newRequest(r.payload), func(ctx context.Context, req *Request) ([]byte, error) {
+		data, err := req.encode()
+		if err != nil {
+			return nil, err
+		}
+		return conn.roundTrip(ctx, req.ID, data)
+	})
+	if err != nil {
+		return err
+	}
+
+	var content struct{ Result json.RawMessage }
+	if err := decodeResponse(raw, &content); err != nil {
+		return err
+	}
+	return r.decode(content.Result)
+}
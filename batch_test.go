@@ -0,0 +1,144 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogmigo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync"
+)
+
+func TestBatch_Send(t *testing.T) {
+	const rewardAddress = "stake1uyfz49rtntfa9h0s98f6s28sg69weemgjhc4e8hm66d5yacalmqha"
+	rewardAddressVfk, err := rewardAccountKey(rewardAddress)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	var connections int64
+	server := httptest.NewServer(rpcHandler(
+		&connections,
+		func(method string, _ json.RawMessage) (interface{}, Map) {
+			switch method {
+			case "queryLedgerState/tip":
+				return Map{"slot": 123, "id": "abc"}, nil
+			case "queryLedgerState/epoch":
+				return 456, nil
+			case "queryLedgerState/eraSummaries":
+				return []Map{{"start": Map{"slot": 0}, "end": Map{"slot": 10}}}, nil
+			case "queryLedgerState/rewardAccountSummaries":
+				return Map{rewardAddressVfk: Map{
+					"delegate": Map{"id": "pool"},
+					"rewards":  Map{"ada": Map{"lovelace": 789}},
+				}}, nil
+			default:
+				return nil, Map{"code": 2002, "message": "unavailable in current era"}
+			}
+		},
+	))
+	defer server.Close()
+
+	client := New(
+		WithEndpoint("ws"+strings.TrimPrefix(server.URL, "http")),
+		WithLogger(NopLogger),
+		WithQueryConnections(4),
+	)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var (
+		tip        chainsync.Point
+		epoch      uint64
+		history    EraHistory
+		start      string
+		delegation Delegation
+		batch      = client.NewBatch()
+	)
+	tipReq := batch.ChainTip(&tip)
+	epochReq := batch.CurrentEpoch(&epoch)
+	historyReq := batch.EraSummaries(&history)
+	startReq := batch.StartTime(&start)
+	delegationReq := batch.GetDelegation(rewardAddress, &delegation)
+
+	if got, want := batch.Len(), 5; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if err := batch.Send(ctx); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	for _, r := range []*BatchRequest{tipReq, epochReq, historyReq, delegationReq} {
+		if err := r.Err(); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+	}
+	if ps, ok := tip.PointStruct(); !ok || ps.Slot != 123 || ps.ID != "abc" {
+		t.Fatalf("got %v; want slot=123 id=abc", tip)
+	}
+	if got, want := epoch, uint64(456); got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := len(history.Summaries), 1; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if delegation.PoolID != "pool" || delegation.Rewards.Int64() != 789 {
+		t.Fatalf("got %#v; want pool with 789 lovelace", delegation)
+	}
+	if startReq.Err() == nil {
+		t.Fatalf("got nil; want error")
+	}
+	if got, want := atomic.LoadInt64(&connections), int64(1); got != want {
+		t.Fatalf("got %v connections; want %v", got, want)
+	}
+}
+
+func TestBatch_SendCanceled(t *testing.T) {
+	var connections int64
+	server := httptest.NewServer(rpcHandler(&connections, func(string, json.RawMessage) (interface{}, Map) {
+		return nil, nil
+	}))
+	defer server.Close()
+
+	client := New(
+		WithEndpoint("ws"+strings.TrimPrefix(server.URL, "http")),
+		WithLogger(NopLogger),
+	)
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var epoch uint64
+	batch := client.NewBatch()
+	batch.CurrentEpoch(&epoch)
+	if err := batch.Send(ctx); err == nil {
+		t.Fatalf("got nil; want err")
+	}
+
+	// the endpoint is not to blame for the canceled context
+	for _, e := range client.endpoints.order() {
+		if e.failures > 0 {
+			t.Fatalf("got %v failures; want 0", e.failures)
+		}
+	}
+}
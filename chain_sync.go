@@ -21,23 +21,25 @@ import (
 	"fmt"
 	"io"
 	"net"
-	"os"
 	"sort"
 	"sync/atomic"
 	"time"
 
 	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync"
+	v5 "github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/v5"
+	"github.com/buger/jsonparser"
 	"github.com/gorilla/websocket"
 	"golang.org/x/sync/errgroup"
 )
 
 // ChainSync provides control over a given ChainSync connection
 type ChainSync struct {
-	cancel context.CancelFunc
-	errs   chan error
-	done   chan struct{}
-	err    error
-	logger Logger
+	cancel   context.CancelFunc
+	errs     chan error
+	done     chan struct{}
+	err      error
+	logger   Logger
+	progress *syncProgress
 }
 
 // Done indicates the ChainSync has terminated prematurely
@@ -66,14 +68,25 @@ type ChainSyncFunc func(ctx context.Context, data []byte) error
 
 // ChainSyncOptions configuration parameters
 type ChainSyncOptions struct {
-	minSlot   uint64           // minSlot to begin invoking ChainSyncFunc; 0 for always invoke func
-	points    chainsync.Points // points to attempt initial intersection
-	reconnect bool             // reconnect to ogmios if connection drops
-	store     Store            // store of points
+	confirmations int                    // confirmations required before a block is delivered
+	decodeWorkers int                    // workers decoding messages ahead of delivery
+	fallback      IntersectionFallback   // policy when no point intersects
+	filters       []TxFilter             // transactions to deliver; empty for all
+	maxSlot       uint64                 // maxSlot after which ChainSync completes; 0 for never
+	minSlot       uint64                 // minSlot to begin invoking ChainSyncFunc; 0 for always invoke func
+	points        chainsync.Points       // points to attempt initial intersection
+	reconnect     bool                   // reconnect to ogmios if connection drops
+	stopPoint     *chainsync.PointStruct // block at which ChainSync completes
+	store         Store                  // store of points
+	synced        SyncedFunc             // invoked on each transition to or from synced
+	syncedSlots   uint64                 // slots from the tip within which ChainSync is synced
+	version       Version                // wire format; VersionUnknown follows the Client
 }
 
 func buildChainSyncOptions(opts ...ChainSyncOption) ChainSyncOptions {
-	var options ChainSyncOptions
+	options := ChainSyncOptions{
+		syncedSlots: defaultSyncedSlots,
+	}
 	for _, opt := range opts {
 		opt(&options)
 	}
@@ -83,9 +96,100 @@ func buildChainSyncOptions(opts ...ChainSyncOption) ChainSyncOptions {
 	return options
 }
 
+// errStopReached signals that the ChainSync has delivered its final block
+var errStopReached = errors.New("chainsync reached stop point")
+
+// bounds reports whether msg lies past the stop point, in which case the
+// ChainSync completes without delivering it, or is the block at the stop
+// point, in which case the ChainSync completes once it has been delivered
+func (o ChainSyncOptions) bounds(msg *syncMessage) (past, at bool, err error) {
+	limit := o.maxSlot
+	if o.stopPoint != nil && (limit == 0 || o.stopPoint.Slot < limit) {
+		limit = o.stopPoint.Slot
+	}
+	if limit == 0 {
+		return false, false, nil
+	}
+
+	point, ok := msg.point()
+	if !ok {
+		return false, false, nil
+	}
+	ps, ok := point.PointStruct()
+	if !ok || ps.Slot < limit {
+		return false, false, nil // origin precedes every stop point
+	}
+	if ps.Slot > limit {
+		if o.stopPoint != nil && o.stopPoint.Slot == limit {
+			return false, false, fmt.Errorf(
+				"chainsync stopped: stop point, %v, not found: chain skips to %v",
+				o.stopPoint.Point(),
+				point,
+			)
+		}
+		return true, false, nil
+	}
+
+	// a rollback to the stop point is followed by the blocks after it
+	if nbr, _ := msg.nextBlock(); nbr.Direction != chainsync.RollForwardString {
+		return false, false, nil
+	}
+	if o.stopPoint != nil && o.stopPoint.Slot == limit && o.stopPoint.ID != ps.ID {
+		return false, false, fmt.Errorf(
+			"chainsync stopped: stop point, %v, not found: chain has %v",
+			o.stopPoint.Point(),
+			point,
+		)
+	}
+	return false, true, nil
+}
+
 // ChainSyncOption provides functional options for ChainSync
 type ChainSyncOption func(opts *ChainSyncOptions)
 
+// WithConfirmations delays delivery of each block until n blocks have been
+// built on top of it, so the callback never sees a block that is later rolled
+// back by fewer than n blocks.  Rollbacks of blocks not yet delivered are
+// applied silently; deeper rollbacks are delivered as usual.  Checkpoints
+// only cover delivered blocks, so a restart neither skips nor repeats any.
+func WithConfirmations(n int) ChainSyncOption {
+	return func(opts *ChainSyncOptions) {
+		opts.confirmations = n
+	}
+}
+
+// WithDecodeWorkers decodes upcoming messages on n goroutines while earlier
+// messages are being delivered, which speeds up historical sync when the
+// handler, rather than ogmios, is the bottleneck.  Messages are still
+// delivered in chain order.  Only ChainSyncWithHandler benefits, as
+// ChainSync hands the callback the undecoded json.
+func WithDecodeWorkers(n int) ChainSyncOption {
+	return func(opts *ChainSyncOptions) {
+		opts.decodeWorkers = n
+	}
+}
+
+// WithMaxSlot completes the ChainSync once the last block at or before the
+// specified slot has been delivered; the final point is saved to the store
+// and Done is closed with a nil error.  Together with WithMinSlot, this
+// allows a historical slice of the chain to be processed as a batch job.
+func WithMaxSlot(slot uint64) ChainSyncOption {
+	return func(opts *ChainSyncOptions) {
+		opts.maxSlot = slot
+	}
+}
+
+// WithStopPoint completes the ChainSync once the block at point has been
+// delivered, as WithMaxSlot does.  Should the chain hold no block, or a
+// different block, at that slot, the ChainSync fails instead.
+func WithStopPoint(point chainsync.Point) ChainSyncOption {
+	return func(opts *ChainSyncOptions) {
+		if ps, ok := point.PointStruct(); ok {
+			opts.stopPoint = ps
+		}
+	}
+}
+
 // WithMinSlot ignores any activity prior to the specified slot
 func WithMinSlot(slot uint64) ChainSyncOption {
 	return func(opts *ChainSyncOptions) {
@@ -100,14 +204,29 @@ func WithPoints(points ...chainsync.Point) ChainSyncOption {
 	}
 }
 
-// WithReconnect attempt to reconnect to ogmios if connection drops
+// WithReconnect attempt to reconnect to ogmios if connection drops; see
+// WithReconnectPolicy
 func WithReconnect(enabled bool) ChainSyncOption {
 	return func(opts *ChainSyncOptions) {
 		opts.reconnect = enabled
 	}
 }
 
-// WithStore specifies store to persist points to; defaults to no persistence
+// WithServerVersion speaks the wire format of the specified ogmios version.
+// By default, ChainSync follows the version detected by the Client (see
+// ServerVersion) and switches to v5 should the server reject v6 messages.
+// Against ogmios v5, responses are converted to their v6 equivalent before
+// being handed to stream interceptors and the ChainSyncFunc; byron blocks
+// cannot be converted and are skipped.
+func WithServerVersion(version Version) ChainSyncOption {
+	return func(opts *ChainSyncOptions) {
+		opts.version = version
+	}
+}
+
+// WithStore specifies store to persist points to; defaults to no persistence.
+// A RollbackStore is told of each rollback, and a TransactionalStore commits
+// each point along with its delivery.
 func WithStore(store Store) ChainSyncOption {
 	return func(opts *ChainSyncOptions) {
 		opts.store = store
@@ -121,67 +240,119 @@ func (c *Client) ChainSync(
 	ctx context.Context,
 	callback ChainSyncFunc,
 	opts ...ChainSyncOption,
+) (*ChainSync, error) {
+	deliver := func(ctx context.Context, msg *syncMessage) error {
+		return callback(ctx, msg.data)
+	}
+	// the callback decodes for itself, so decoding ahead would be wasted
+	opts = append(opts, WithDecodeWorkers(0))
+	return c.chainSync(ctx, deliver, opts...)
+}
+
+// ChainSyncHandler receives the decoded ChainSync messages.  tip holds the
+// tip of the chain as reported alongside each message.
+type ChainSyncHandler interface {
+	// OnIntersection is invoked once per connection with the point ChainSync
+	// resumes from
+	OnIntersection(ctx context.Context, point chainsync.Point, tip chainsync.PointStruct) error
+	// OnRollForward is invoked with each new block
+	OnRollForward(ctx context.Context, block *chainsync.Block, tip chainsync.PointStruct) error
+	// OnRollBackward is invoked when the chain rolls back to point; blocks
+	// after point are no longer part of the chain
+	OnRollBackward(ctx context.Context, point chainsync.Point, tip chainsync.PointStruct) error
+}
+
+// ChainSyncWithHandler is equivalent to ChainSync, but hands each message to
+// handler already decoded.  Should ogmios fail to find an intersection,
+// ChainSyncWithHandler stops with an error matching ErrIntersectionNotFound
+// unless WithIntersectionFallback provides another.
+func (c *Client) ChainSyncWithHandler(
+	ctx context.Context,
+	handler ChainSyncHandler,
+	opts ...ChainSyncOption,
+) (*ChainSync, error) {
+	deliver := func(ctx context.Context, msg *syncMessage) error {
+		return msg.handle(ctx, handler)
+	}
+	return c.chainSync(ctx, deliver, opts...)
+}
+
+// chainSync runs the ChainSync protocol, passing each message to deliver
+func (c *Client) chainSync(
+	ctx context.Context,
+	deliver func(ctx context.Context, msg *syncMessage) error,
+	opts ...ChainSyncOption,
 ) (*ChainSync, error) {
 	options := buildChainSyncOptions(opts...)
 
 	done := make(chan struct{})
 	errs := make(chan error, 1)
 	ctx, cancel := context.WithCancel(ctx)
+	progress := newSyncProgress(options.syncedSlots)
 
 	go func() {
 		defer close(done)
 
-		var (
-			timeout = 10 * time.Second
-			err     error
-		)
-		for {
-			err = c.doChainSync(ctx, callback, options)
-			if err != nil && isTemporaryError(err) {
-				if options.reconnect {
-					c.options.logger.Info(
-						"websocket connection error: will retry",
-						KV("delay", timeout.Round(time.Millisecond).String()),
-						KV("err", err.Error()),
-					)
-
-					select {
-					case <-ctx.Done():
-						return
-					case <-time.After(timeout):
-						continue
-					}
+		// last survives reconnects so a new connection, possibly to another
+		// endpoint, resumes from the most recently processed point
+		last := newCircular[*syncMessage](3)
+		errs <- c.reconnect(
+			ctx,
+			ProtocolChainSync,
+			options.reconnect,
+			func(ctx context.Context, connected func()) error {
+				err := c.doChainSync(ctx, deliver, options, last, progress, connected)
+				var ve *versionError
+				if errors.As(err, &ve) && options.version == VersionUnknown {
+					// retry in the wire format the server speaks
+					return c.doChainSync(ctx, deliver, options, last, progress, connected)
 				}
-			}
-
-			break
-		}
-		errs <- err
+				return err
+			},
+		)
 	}()
 
 	return &ChainSync{
-		cancel: cancel,
-		errs:   errs,
-		done:   done,
-		logger: c.logger,
+		cancel:   cancel,
+		errs:     errs,
+		done:     done,
+		logger:   c.logger,
+		progress: progress,
 	}, nil
 }
 
 func (c *Client) doChainSync(
 	ctx context.Context,
-	callback ChainSyncFunc,
+	deliver func(ctx context.Context, msg *syncMessage) error,
 	options ChainSyncOptions,
-) error {
-	conn, _, err := websocket.DefaultDialer.Dial(c.options.endpoint, nil)
+	last *circular[*syncMessage],
+	progress *syncProgress,
+	connected func(),
+) (err error) {
+	conn, e, err := c.dial(ctx)
 	if err != nil {
-		return fmt.Errorf(
-			"failed to connect to ogmios, %v: %w",
-			c.options.endpoint,
-			err,
-		)
+		return err
+	}
+	connected()
+	defer func() {
+		if err != nil && IsTemporaryError(err) {
+			c.endpoints.failed(e)
+		}
+	}()
+
+	store := options.store
+	if msgs := last.list(); len(msgs) > 0 {
+		if point, ok := msgs[len(msgs)-1].point(); ok {
+			store = resumeStore{Store: store, point: point}
+		}
 	}
 
-	init, err := getInit(ctx, options.store, options.points...)
+	intersect, next, err := c.syncRequests(ctx, options, store)
+	if err != nil {
+		return err
+	}
+	version := intersect.version
+	init, err := intersect.request()
 	if err != nil {
 		return fmt.Errorf("failed to create init message: %w", err)
 	}
@@ -214,33 +385,259 @@ func (c *Client) doChainSync(
 		}
 	}
 
+	// with a fallback, nextBlock requests wait for the intersection, as
+	// ogmios would otherwise roll forward from origin once findIntersection
+	// fails; the reader hands the writer any further findIntersection
+	var (
+		intersected = make(chan struct{})
+		reinit      = make(chan []byte, 1)
+	)
+	var inFlight int64 // nextBlock requests awaiting a response
 	group.Go(func() error {
-		if err := conn.WriteMessage(websocket.TextMessage, init); err != nil {
-			var oe *net.OpError
-			if ok := errors.As(err, &oe); ok {
-				if v := atomic.LoadInt64(&connState); v > 0 {
-					return nil // connection closed
+		write := writeStream(conn)
+		for waiting := true; waiting; {
+			if err := c.interceptStream(ctx, Outbound, init, write); err != nil {
+				var oe *net.OpError
+				if ok := errors.As(err, &oe); ok {
+					if v := atomic.LoadInt64(&connState); v > 0 {
+						return nil // connection closed
+					}
 				}
+				return fmt.Errorf("failed to write FindIntersect: %w", err)
+			}
+			if options.fallback == IntersectionFallbackNone {
+				break
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-intersected:
+				waiting = false
+			case init = <-reinit:
 			}
-			return fmt.Errorf("failed to write FindIntersect: %w", err)
 		}
 
-		next := []byte(`{"jsonrpc":"2.0","method":"nextBlock","id":{}}`)
 		for {
 			select {
 			case <-ctx.Done():
 				return nil
 			case <-ch:
-				if err := conn.WriteMessage(websocket.TextMessage, next); err != nil {
+				if err := c.interceptStream(ctx, Outbound, next, write); err != nil {
 					return fmt.Errorf("failed to write RequestNext: %w", err)
 				}
+				atomic.AddInt64(&inFlight, 1)
 			}
 		}
 	})
 
+	// blocks awaiting confirmation are discarded with the connection; the
+	// next connection resumes from the most recently delivered block
+	var pending *confirmations
+	if options.confirmations > 0 {
+		pending = newConfirmations(options.confirmations, last.list())
+	}
+
+	// finish saves the most recently processed point as the chainsync stops
+	// a TransactionalStore commits each point along with its delivery, so
+	// the periodic and final saves, of older points, are skipped
+	ts, transactional := options.store.(TransactionalStore)
+	finish := func() error {
+		if transactional {
+			return nil
+		}
+		if point, ok := firstPoint(last.list()...); ok {
+			if err := c.save(context.Background(), options.store, point); err != nil {
+				return fmt.Errorf("chainsync client failed: %w", err)
+			}
+		}
+		return nil
+	}
+
+	// complete saves the final point delivered once the stop point or max
+	// slot is reached; with no blocks to follow, none can roll it back
+	complete := func() error {
+		if transactional {
+			return nil
+		}
+		list := last.list()
+		for i := len(list) - 1; i >= 0; i-- {
+			if point, ok := list[i].point(); ok {
+				if err := c.save(context.Background(), options.store, point); err != nil {
+					return fmt.Errorf("chainsync client failed: %w", err)
+				}
+				return nil
+			}
+		}
+		return nil
+	}
+
+	// process filters, delivers and checkpoints each message in chain order
+	var (
+		checkSlot = options.minSlot > 0
+		delivered uint64 // messages delivered, for the save interval
+	)
+	process := func(ctx context.Context, msg *syncMessage) error {
+		// allow rapid bypassing of earlier slots
+		if checkSlot {
+			if point, ok := msg.point(); ok {
+				if ps, ok := point.PointStruct(); ok {
+					if ps.Slot < options.minSlot {
+						return nil
+					}
+					checkSlot = false
+				}
+			}
+		}
+
+		settled := []*syncMessage{msg}
+		if pending != nil {
+			settled = pending.push(msg)
+		}
+		for _, m := range settled {
+			past, at, err := options.bounds(m)
+			if err != nil {
+				return err
+			}
+			if past {
+				if err := complete(); err != nil {
+					return err
+				}
+				return errStopReached
+			}
+
+			var callbackErr error
+			call := func(ctx context.Context) error {
+				started := time.Now()
+				callbackErr = deliver(ctx, m)
+				if c.observing() {
+					c.observe(ctx, CallbackEvent{
+						Protocol: ProtocolChainSync,
+						Duration: time.Since(started),
+						Err:      callbackErr,
+					})
+				}
+				return callbackErr
+			}
+			// only a TransactionalStore needs the point, which saves raw
+			// callbacks from decoding every message
+			var point chainsync.Point
+			var ok bool
+			if transactional {
+				point, ok = m.point()
+			}
+			if ok {
+				err = c.transact(ctx, ts, point, call)
+			} else {
+				err = call(ctx)
+			}
+			if callbackErr != nil {
+				return fmt.Errorf("chainsync stopped: callback failed: %w", callbackErr)
+			}
+			if err != nil {
+				return fmt.Errorf("chainsync client failed: %w", err)
+			}
+			if c.observing() {
+				c.observeDelivered(ctx, m.data)
+			}
+			if p, changed := progress.update(m.data); changed && options.synced != nil {
+				options.synced(ctx, p)
+			}
+			if err := pruneRollback(ctx, options.store, m); err != nil {
+				return fmt.Errorf("chainsync client failed: %w", err)
+			}
+
+			// periodically save points to the store to allow graceful recovery
+			if delivered++; !transactional && delivered%c.options.saveInterval == 0 {
+				if point, ok := firstPoint(last.prefix(m)...); ok {
+					if err := c.save(ctx, options.store, point); err != nil {
+						return fmt.Errorf("chainsync client failed: %w", err)
+					}
+				}
+			}
+			last.add(m)
+
+			if at {
+				if err := complete(); err != nil {
+					return err
+				}
+				return errStopReached
+			}
+		}
+		return nil
+	}
+
+	// with decode workers, messages are decoded in parallel ahead of an
+	// ordered processor, which then owns last and finish
+	var decoded chan *syncMessage
+	if workers := options.decodeWorkers; workers > 0 {
+		var (
+			jobs    = make(chan *syncMessage, 2*workers)
+			ordered = make(chan *syncMessage, 2*workers)
+		)
+		decoded = make(chan *syncMessage)
+		group.Go(func() error {
+			defer close(jobs)
+			defer close(ordered)
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case msg, ok := <-decoded:
+					if !ok {
+						return nil
+					}
+					msg.ready = make(chan struct{})
+					select {
+					case jobs <- msg:
+					case <-ctx.Done():
+						return nil
+					}
+					select {
+					case ordered <- msg:
+					case <-ctx.Done():
+						return nil
+					}
+				}
+			}
+		})
+		for i := 0; i < workers; i++ {
+			group.Go(func() error {
+				for msg := range jobs {
+					_, _ = msg.decode()
+					close(msg.ready)
+				}
+				return nil
+			})
+		}
+		group.Go(func() error {
+			for {
+				select {
+				case <-ctx.Done():
+					return finish()
+				case msg, ok := <-ordered:
+					if !ok {
+						return finish()
+					}
+					select {
+					case <-msg.ready:
+					case <-ctx.Done():
+						return finish()
+					}
+					if err := process(ctx, msg); err != nil {
+						return err
+					}
+				}
+			}
+		})
+	}
+
 	group.Go(func() error {
-		checkSlot := options.minSlot > 0
-		last := newCircular(3)
+		if decoded != nil {
+			defer close(decoded)
+		}
+
+		var lastSlot uint64 // slot of the most recent block, for observers
 		for n := uint64(1); ; n++ {
 			messageType, data, err := conn.ReadMessage()
 			if err != nil {
@@ -256,15 +653,19 @@ func (c *Client) doChainSync(
 				return fmt.Errorf("failed to read message from ogmios: %w", err)
 			}
 
+			// each response but those to findIntersection makes room for
+			// another request
+			var pump chan struct{}
+			if intersect.found {
+				pump = ch
+			}
 			select {
 			case <-ctx.Done():
-				if point, ok := getPoint(last.list()...); ok {
-					if err := options.store.Save(context.Background(), point); err != nil {
-						return fmt.Errorf("chainsync client failed: %w", err)
-					}
+				if decoded != nil {
+					return nil
 				}
-				return nil
-			case ch <- struct{}{}:
+				return finish()
+			case pump <- struct{}{}:
 				// request the next message
 			default:
 				// pump is full
@@ -276,12 +677,10 @@ func (c *Client) doChainSync(
 				continue
 
 			case websocket.CloseMessage:
-				if point, ok := getPoint(last.list()...); ok {
-					if err := options.store.Save(context.Background(), point); err != nil {
-						return fmt.Errorf("chainsync client failed: %w", err)
-					}
+				if decoded != nil {
+					return nil
 				}
-				return nil
+				return finish()
 
 			case websocket.PingMessage:
 				if err := conn.WriteMessage(websocket.PongMessage, nil); err != nil {
@@ -299,34 +698,121 @@ func (c *Client) doChainSync(
 				// ok
 			}
 
-			// allow rapid bypassing of earlier slots
-			if checkSlot {
-				if point, ok := getPoint(data); ok {
-					if ps, ok := point.PointStruct(); ok {
-						if ps.Slot < options.minSlot {
-							continue
-						}
-						checkSlot = false
+			// a server that cannot parse FindIntersect replies in its own wire format
+			if n == 1 {
+				if v, ok := rejectedBy(data); ok && v != version {
+					c.setServerVersion(v)
+					return &versionError{version: v}
+				}
+			}
+			if version == Version5 {
+				if data, err = responseFromV5(data); err != nil {
+					return fmt.Errorf("chainsync stopped: %w", err)
+				}
+				if data == nil {
+					c.options.logger.Debug("skipping byron block")
+					if c.observing() {
+						atomic.AddInt64(&inFlight, -1)
 					}
+					continue
 				}
 			}
 
-			if err := callback(ctx, data); err != nil {
-				return fmt.Errorf("chainsync stopped: callback failed: %w", err)
+			var delivered bool
+			err = c.interceptStream(ctx, Inbound, data, func(_ context.Context, msg *StreamMessage) error {
+				data, delivered = msg.Data, true
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("chainsync stopped: interceptor failed: %w", err)
+			}
+			if !delivered {
+				continue
 			}
 
-			// periodically save points to the store to allow graceful recovery
-			if n%c.options.saveInterval == 0 {
-				if point, ok := getPoint(last.prefix(data)...); ok {
-					if err := options.store.Save(ctx, point); err != nil {
-						return fmt.Errorf("chainsync client failed: %w", err)
+			if !intersect.found {
+				retry, err := intersect.receive(data)
+				if err != nil {
+					return fmt.Errorf("chainsync stopped: %w", err)
+				}
+				if retry != nil {
+					select {
+					case reinit <- retry:
+					case <-ctx.Done():
+						if decoded != nil {
+							return nil
+						}
+						return finish()
 					}
+					continue
 				}
+				close(intersected)
+				c.reportIntersection(ctx, intersect, data)
+			}
+
+			if c.observing() {
+				if method, _ := jsonparser.GetString(data, "method"); method == chainsync.NextBlockMethod {
+					c.observe(ctx, PipelineEvent{
+						InFlight: int(atomic.AddInt64(&inFlight, -1)),
+						Capacity: c.options.pipeline,
+					})
+					c.observeNextBlock(ctx, data, &lastSlot)
+				}
+			}
+
+			if len(options.filters) > 0 {
+				if data, err = filterBlock(data, options.filters); err != nil {
+					return fmt.Errorf("chainsync stopped: failed to filter block: %w", err)
+				}
+			}
+
+			msg := &syncMessage{data: data}
+			if decoded == nil {
+				if err := process(ctx, msg); err != nil {
+					return err
+				}
+				continue
+			}
+			select {
+			case decoded <- msg:
+			case <-ctx.Done():
+				return nil
 			}
-			last.add(data)
 		}
 	})
-	return group.Wait()
+	if err := group.Wait(); !errors.Is(err, errStopReached) {
+		return err
+	}
+	c.options.logger.Info("ogmigo chainsync completed")
+	return nil
+}
+
+// syncRequests returns the intersection, holding the wire version and the
+// points to offer, along with the nextBlock request for a new chainsync
+// connection
+func (c *Client) syncRequests(
+	ctx context.Context,
+	options ChainSyncOptions,
+	store Store,
+) (i *intersection, next []byte, err error) {
+	version := options.version
+	if version == VersionUnknown {
+		version = c.serverVersion()
+	}
+	if version != Version5 {
+		version = Version6
+	}
+
+	if version == Version5 {
+		next = []byte(`{"type":"jsonwsp/request","version":"1.0","servicename":"ogmios","methodname":"RequestNext","args":{}}`)
+	} else {
+		next = []byte(`{"jsonrpc":"2.0","method":"nextBlock","id":{}}`)
+	}
+	i, err = newIntersection(ctx, options.fallback, version, store, options.points...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create init message: %w", err)
+	}
+	return i, next, nil
 }
 
 func getInit(
@@ -334,6 +820,131 @@ func getInit(
 	store Store,
 	pp ...chainsync.Point,
 ) (data []byte, err error) {
+	points, err := initPoints(ctx, store, pp...)
+	if err != nil {
+		return nil, err
+	}
+
+	init := Map{
+		"jsonrpc": "2.0",
+		"method":  "findIntersection",
+		"params":  Map{"points": points},
+		"id":      Map{"step": "INIT"},
+	}
+	return json.Marshal(init)
+}
+
+// confirmations buffers forward blocks until depth blocks have been built
+// on top of them
+type confirmations struct {
+	depth   int
+	blocks  []*syncMessage
+	settled *chainsync.Point // most recently delivered point
+}
+
+// newConfirmations returns a buffer resuming after the most recently
+// delivered of the messages, if any
+func newConfirmations(depth int, delivered []*syncMessage) *confirmations {
+	c := &confirmations{depth: depth}
+	for i := len(delivered) - 1; i >= 0; i-- {
+		if point, ok := delivered[i].point(); ok {
+			c.settled = &point
+			break
+		}
+	}
+	return c
+}
+
+// push adds msg to the buffer and returns the messages, in order, that are
+// ready to be delivered
+func (c *confirmations) push(msg *syncMessage) []*syncMessage {
+	nbr, ok := msg.nextBlock()
+	if !ok {
+		return []*syncMessage{msg}
+	}
+
+	switch nbr.Direction {
+	case chainsync.RollForwardString:
+		c.blocks = append(c.blocks, msg)
+		if len(c.blocks) <= c.depth {
+			return nil
+		}
+		settled := c.blocks[0]
+		c.blocks = c.blocks[1:]
+		if point, ok := settled.point(); ok {
+			c.settled = &point
+		}
+		return []*syncMessage{settled}
+
+	case chainsync.RollBackwardString:
+		if nbr.Point == nil {
+			return []*syncMessage{msg}
+		}
+		ps, ok := nbr.Point.PointStruct()
+		if !ok {
+			// rollback to origin
+			c.blocks, c.settled = nil, nil
+			return []*syncMessage{msg}
+		}
+
+		inside := len(c.blocks) > 0 && ps.Slot >= c.blockSlot(0)
+		if c.settled != nil {
+			if settled, ok := c.settled.PointStruct(); ok && ps.Slot >= settled.Slot {
+				inside = true
+			}
+		}
+
+		for i := range c.blocks {
+			if c.blockSlot(i) > ps.Slot {
+				c.blocks = c.blocks[:i]
+				break
+			}
+		}
+		if inside {
+			return nil
+		}
+		point := *nbr.Point
+		c.settled = &point
+		return []*syncMessage{msg}
+	}
+	return []*syncMessage{msg}
+}
+
+func (c *confirmations) blockSlot(i int) uint64 {
+	point, _ := c.blocks[i].point()
+	if ps, ok := point.PointStruct(); ok {
+		return ps.Slot
+	}
+	return 0
+}
+
+// getInitV5 is the ogmios v5 equivalent of getInit
+func getInitV5(
+	ctx context.Context,
+	store Store,
+	pp ...chainsync.Point,
+) (data []byte, err error) {
+	points, err := initPoints(ctx, store, pp...)
+	if err != nil {
+		return nil, err
+	}
+
+	pointsV5 := make([]*v5.PointV5, 0, len(points))
+	for _, p := range points {
+		pointsV5 = append(pointsV5, v5.PointFromV6(p))
+	}
+	init := makePayloadV5(chainsync.FindIntersectMethod, Map{"points": pointsV5})
+	init["mirror"] = Map{"step": "INIT"}
+	return json.Marshal(init)
+}
+
+// initPoints returns the points to intersect with, preferring those in the
+// store over the points provided; see spreadPoints
+func initPoints(
+	ctx context.Context,
+	store Store,
+	pp ...chainsync.Point,
+) (chainsync.Points, error) {
 	points, err := store.Load(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve points from store: %w", err)
@@ -345,66 +956,211 @@ func getInit(
 		points = append(points, chainsync.Origin)
 	}
 	sort.Sort(points)
-	if len(points) > 5 {
-		points = points[0:5]
+	return spreadPoints(points), nil
+}
+
+const (
+	// securityParam is the number of blocks, k, after which a block can no
+	// longer be rolled back
+	securityParam = 2160
+	// slotsPerBlock estimates the depth in blocks of points without a height
+	slotsPerBlock = 20
+)
+
+// spreadPoints returns at most maxIntersectPoints of the points, which are
+// sorted newest first: the most recent, to resume without repeating blocks,
+// and the newest point at least securityParam blocks behind them, or failing
+// that the oldest, to intersect with after even the deepest rollback
+func spreadPoints(points chainsync.Points) chainsync.Points {
+	if len(points) <= maxIntersectPoints {
+		return points
 	}
 
-	init := Map{
-		"jsonrpc": "2.0",
-		"method":  "findIntersection",
-		"params":  Map{"points": points},
-		"id":      Map{"step": "INIT"},
+	spread := append(chainsync.Points{}, points[:maxIntersectPoints-1]...)
+	newest, ok := points[0].PointStruct()
+	if !ok {
+		return append(spread, points[len(points)-1])
 	}
-	return json.Marshal(init)
+	for _, point := range points[maxIntersectPoints-1:] {
+		ps, ok := point.PointStruct()
+		if !ok {
+			break
+		}
+		depth := (newest.Slot - ps.Slot) / slotsPerBlock
+		if newest.Height != nil && ps.Height != nil {
+			depth = *newest.Height - *ps.Height
+		}
+		if depth >= securityParam {
+			return append(spread, point)
+		}
+	}
+	return append(spread, points[len(points)-1])
+}
+
+// responseFromV5 converts an ogmios v5 chainsync response into the json
+// encoded chainsync.ResponsePraos.  Byron blocks cannot be converted, so nil
+// is returned in their place.
+func responseFromV5(data []byte) ([]byte, error) {
+	var response v5.ResponseV5
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("failed to decode ogmios v5 response: %w", err)
+	}
+	if response.Type == string(fault) {
+		var e Error
+		if err := json.Unmarshal(data, &e); err != nil {
+			return nil, fmt.Errorf("failed to decode error: %w", err)
+		}
+		return nil, e
+	}
+	if response.Result == nil {
+		return nil, fmt.Errorf("unexpected ogmios v5 response: %s", data)
+	}
+	if rf := response.Result.RollForward; rf != nil && rf.Block.GetNonByronBlock() == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(response.ConvertToV6())
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode ogmios v5 response: %w", err)
+	}
+	return data, nil
+}
+
+// resumeStore offers the point most recently processed by a previous
+// connection ahead of the points saved in the underlying Store
+type resumeStore struct {
+	Store
+	point chainsync.Point
+}
+
+func (r resumeStore) Load(ctx context.Context) (chainsync.Points, error) {
+	points, err := r.Store.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return append(chainsync.Points{r.point}, points...), nil
 }
 
 // getPoint returns the first point from the list of json encoded chainsync.Responses provided
 // multiple Responses allow for the possibility of a Rollback being included in the set
 func getPoint(data ...[]byte) (chainsync.Point, bool) {
+	msgs := make([]*syncMessage, 0, len(data))
 	for _, d := range data {
-		if len(d) == 0 {
-			continue
-		}
-
-		var response chainsync.ResponsePraos
-		if err := json.Unmarshal(d, &response); err == nil {
-			if response.Method == chainsync.NextBlockMethod {
-				nbr := response.MustNextBlockResult()
-				switch nbr.Direction {
-				case chainsync.RollForwardString:
-					ps := nbr.Block.PointStruct()
-					return ps.Point(), true
-				case chainsync.RollBackwardString:
-					return *nbr.Point, true
-				}
-			}
+		msgs = append(msgs, &syncMessage{data: d})
+	}
+	return firstPoint(msgs...)
+}
+
+// firstPoint returns the point of the first message that carries one
+func firstPoint(msgs ...*syncMessage) (chainsync.Point, bool) {
+	for _, msg := range msgs {
+		if point, ok := msg.point(); ok {
+			return point, true
 		}
 	}
 	return chainsync.Point{}, false
 }
 
-// isTemporaryError returns true if the error is recoverable
-func isTemporaryError(err error) bool {
-	wce := &websocket.CloseError{}
-	if ok := errors.As(err, &wce); ok &&
-		wce.Code == websocket.CloseAbnormalClosure {
-		return true
+// syncMessage holds a json encoded chainsync.Response, which is decoded at
+// most once, on first use, whether by the handler, minSlot filtering or
+// checkpointing
+type syncMessage struct {
+	data     []byte
+	ready    chan struct{} // closed once decoded by a decode worker
+	decoded  bool
+	response chainsync.ResponsePraos
+	err      error
+}
+
+// decodes counts the messages decoded, which allows tests to verify that
+// raw callbacks are handed the json without it being decoded
+var decodes int64
+
+func (m *syncMessage) decode() (*chainsync.ResponsePraos, error) {
+	if !m.decoded {
+		m.decoded = true
+		atomic.AddInt64(&decodes, 1)
+		if err := json.Unmarshal(m.data, &m.response); err != nil {
+			m.err = fmt.Errorf("failed to decode chainsync response: %w", err)
+		}
+	}
+	return &m.response, m.err
+}
+
+// nextBlock returns the nextBlock result carried by the message, if any
+func (m *syncMessage) nextBlock() (chainsync.ResultNextBlockPraos, bool) {
+	response, err := m.decode()
+	if err != nil || response.Method != chainsync.NextBlockMethod || response.Error != nil {
+		return chainsync.ResultNextBlockPraos{}, false
 	}
+	return response.MustNextBlockResult(), true
+}
 
-	noe := &net.OpError{}
-	if ok := errors.As(err, &noe); ok {
-		sce := &os.SyscallError{}
-		if ok := errors.As(noe.Err, &sce); ok && sce.Syscall == "connect" {
-			return true
+func (m *syncMessage) point() (chainsync.Point, bool) {
+	if len(m.data) == 0 {
+		return chainsync.Point{}, false
+	}
+	nbr, ok := m.nextBlock()
+	if !ok {
+		return chainsync.Point{}, false
+	}
+	switch nbr.Direction {
+	case chainsync.RollForwardString:
+		if nbr.Block != nil {
+			return nbr.Block.PointStruct().Point(), true
 		}
-		return noe.Temporary()
+	case chainsync.RollBackwardString:
+		if nbr.Point != nil {
+			return *nbr.Point, true
+		}
+	}
+	return chainsync.Point{}, false
+}
+
+// handle passes the decoded message to the matching handler method
+func (m *syncMessage) handle(ctx context.Context, handler ChainSyncHandler) error {
+	response, err := m.decode()
+	if err != nil {
+		return err
+	}
+	if response.Error != nil {
+		method, _ := jsonparser.GetString(m.data, "method")
+		return FromResultError(method, response.Error)
 	}
 
-	// handle the generic temporary error
-	var temp interface{ Temporary() bool }
-	if ok := errors.As(err, &temp); ok {
-		return temp.Temporary()
+	tipOf := func(tip *chainsync.PointStruct) chainsync.PointStruct {
+		if tip == nil {
+			return chainsync.PointStruct{}
+		}
+		return *tip
 	}
 
-	return false
+	switch response.Method {
+	case chainsync.FindIntersectionMethod:
+		result := response.MustFindIntersectResult()
+		if result.Error != nil {
+			return FromResultError(chainsync.FindIntersectionMethod, result.Error)
+		}
+		point := chainsync.Origin
+		if result.Intersection != nil {
+			point = *result.Intersection
+		}
+		return handler.OnIntersection(ctx, point, tipOf(result.Tip))
+
+	case chainsync.NextBlockMethod:
+		result := response.MustNextBlockResult()
+		switch result.Direction {
+		case chainsync.RollForwardString:
+			if result.Block == nil {
+				return fmt.Errorf("failed to decode chainsync response: roll forward without block")
+			}
+			return handler.OnRollForward(ctx, result.Block, tipOf(result.Tip))
+		case chainsync.RollBackwardString:
+			if result.Point == nil {
+				return fmt.Errorf("failed to decode chainsync response: roll backward without point")
+			}
+			return handler.OnRollBackward(ctx, *result.Point, tipOf(result.Tip))
+		}
+	}
+	return fmt.Errorf("unexpected chainsync response: %s", m.data)
 }
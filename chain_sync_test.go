@@ -18,9 +18,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"reflect"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -28,7 +31,10 @@ import (
 	"golang.org/x/text/language"
 	"golang.org/x/text/message"
 
+	"github.com/SundaeSwap-finance/ogmigo/v6/ogmiostest"
 	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync"
+	"github.com/buger/jsonparser"
+	"github.com/gorilla/websocket"
 	"github.com/tj/assert"
 )
 
@@ -151,3 +157,697 @@ func Test_getInit(t *testing.T) {
 		assert.EqualValues(t, string(points), want)
 	})
 }
+
+func Test_spreadPoints(t *testing.T) {
+	var points chainsync.Points
+	for height := uint64(3000); height > 0; height -= 100 {
+		points = append(points, testBlock(height, "id").PointStruct().Point())
+	}
+
+	var got []uint64
+	for _, p := range spreadPoints(points) {
+		ps, _ := p.PointStruct()
+		got = append(got, *ps.Height)
+	}
+	if want := []uint64{3000, 2900, 2800, 2700, 800}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+
+	// without a point k blocks back, the oldest is offered
+	got = got[:0]
+	for _, p := range spreadPoints(points[:10]) {
+		ps, _ := p.PointStruct()
+		got = append(got, *ps.Height)
+	}
+	if want := []uint64{3000, 2900, 2800, 2700, 2100}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
+
+func Test_getInitV5(t *testing.T) {
+	ctx := context.Background()
+	p1 := chainsync.PointStruct{
+		ID:   "hash",
+		Slot: 456,
+	}
+
+	points, err := getInitV5(ctx, mockStore{}, p1.Point())
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	want := `{"args":{"points":[{"hash":"hash","slot":456}]},"methodname":"FindIntersect","mirror":{"step":"INIT"},"servicename":"ogmios","type":"jsonwsp/request","version":"1.0"}`
+	assert.EqualValues(t, string(points), want)
+}
+
+// memoryChainSyncV5 mimics the ogmios v5 chainsync protocol, replying to
+// each RequestNext with the next of results and rejecting JSON-RPC messages
+func memoryChainSyncV5(rejected *int64, results ...string) MemoryHandler {
+	return func(ctx context.Context, conn Conn) {
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			var request struct {
+				JSONRPC    string
+				MethodName string `json:"methodname"`
+				Mirror     json.RawMessage
+			}
+			if err := json.Unmarshal(data, &request); err != nil {
+				return
+			}
+
+			var response string
+			switch {
+			case request.JSONRPC != "":
+				atomic.AddInt64(rejected, 1)
+				response = `{"type":"jsonwsp/fault","version":"1.0","servicename":"ogmios","fault":{"code":"client","string":"invalid request"},"reflection":null}`
+			case request.MethodName == chainsync.FindIntersectMethod:
+				response = `{"type":"jsonwsp/response","version":"1.0","servicename":"ogmios","methodname":"FindIntersect","result":{"IntersectionFound":{"point":"origin","tip":{"slot":62344,"hash":"2208","blockNo":2}}}}`
+			case len(results) > 0:
+				response = `{"type":"jsonwsp/response","version":"1.0","servicename":"ogmios","methodname":"RequestNext","result":` + results[0] + `}`
+				results = results[1:]
+			default:
+				continue // at the tip
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(response)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func TestClient_ChainSyncV5(t *testing.T) {
+	rollBackward, err := os.ReadFile("ouroboros/chainsync/compatibility/test_data/RollBackward_v5.json")
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	rollForward, err := os.ReadFile("ouroboros/chainsync/compatibility/test_data/RealWorld_RollForward_v5.json")
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	var (
+		rejected int64
+		received = make(chan chainsync.ResponsePraos, 3)
+		client   = New(WithTransport(NewMemoryTransport(memoryChainSyncV5(&rejected, string(rollBackward), string(rollForward)))))
+	)
+	defer client.Close()
+
+	callback := func(ctx context.Context, data []byte) error {
+		var response chainsync.ResponsePraos
+		if err := json.Unmarshal(data, &response); err != nil {
+			return err
+		}
+		received <- response
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	closer, err := client.ChainSync(ctx, callback)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	defer closer.Close()
+
+	var responses []chainsync.ResponsePraos
+	for len(responses) < 3 {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("got %v responses; want 3", len(responses))
+		case response := <-received:
+			responses = append(responses, response)
+		}
+	}
+
+	if got, want := responses[0].Method, chainsync.FindIntersectionMethod; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := responses[1].MustNextBlockResult().Point.String(), "slot=92267 id=6487fa2e6f0e85ef6e887931381057146060bfd2ed7324f7829c369c3628dc16"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	result := responses[2].MustNextBlockResult()
+	if got, want := result.Direction, chainsync.RollForwardString; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := result.Block.Transactions[0].ID, "03a67c5103c2284ddcb09c60fd79c5c2554ca600bc0c7ae4b55268038ba3af35"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+
+	if got, want := atomic.LoadInt64(&rejected), int64(1); got < want {
+		t.Fatalf("got %v rejected; want at least %v", got, want)
+	}
+	if got, want := client.serverVersion(), Version5; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
+
+// handlerRecorder records the events delivered to a ChainSyncHandler
+type handlerRecorder struct {
+	intersections []chainsync.Point
+	blocks        []*chainsync.Block
+	tips          []chainsync.PointStruct
+	done          chan struct{}
+	want          int
+}
+
+func (h *handlerRecorder) OnIntersection(_ context.Context, point chainsync.Point, tip chainsync.PointStruct) error {
+	h.intersections = append(h.intersections, point)
+	h.tips = append(h.tips, tip)
+	return nil
+}
+
+func (h *handlerRecorder) OnRollForward(_ context.Context, block *chainsync.Block, tip chainsync.PointStruct) error {
+	h.blocks = append(h.blocks, block)
+	h.tips = append(h.tips, tip)
+	if len(h.blocks) == h.want {
+		close(h.done)
+	}
+	return nil
+}
+
+func (h *handlerRecorder) OnRollBackward(context.Context, chainsync.Point, chainsync.PointStruct) error {
+	return fmt.Errorf("unexpected rollback")
+}
+
+func TestClient_ChainSyncWithHandler(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := New(
+		WithTransport(NewMemoryTransport(memoryOgmios(10))),
+		WithLogger(NopLogger),
+	)
+	defer client.Close()
+
+	t.Run("blocks", func(t *testing.T) {
+		handler := &handlerRecorder{done: make(chan struct{}), want: 5}
+		closer, err := client.ChainSyncWithHandler(ctx, handler, WithMinSlot(60))
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			t.Fatalf("got %v blocks; want %v", len(handler.blocks), handler.want)
+		case <-handler.done:
+		}
+		_ = closer.Close()
+		<-closer.Done()
+
+		// minSlot skips blocks 1-5, but not the intersection
+		if got := len(handler.intersections); got != 1 {
+			t.Fatalf("got %v intersections; want 1", got)
+		}
+		if got, want := handler.blocks[0].Slot, uint64(60); got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := handler.tips[0].Slot, uint64(100); got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("intersection", func(t *testing.T) {
+		handler := &handlerRecorder{done: make(chan struct{}), want: 1}
+		closer, err := client.ChainSyncWithHandler(ctx, handler)
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			t.Fatalf("got %v blocks; want %v", len(handler.blocks), handler.want)
+		case <-handler.done:
+		}
+		_ = closer.Close()
+		<-closer.Done()
+
+		if got, want := handler.intersections, []chainsync.Point{chainsync.Origin}; len(got) != 1 || got[0].String() != want[0].String() {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+}
+
+func TestSyncMessage_handle(t *testing.T) {
+	msg := &syncMessage{
+		data: []byte(`{"jsonrpc":"2.0","method":"findIntersection","error":{"code":1000,"message":"no intersection","data":{"tip":"origin"}},"id":null}`),
+	}
+	err := msg.handle(context.Background(), &handlerRecorder{})
+	if !errors.Is(err, ErrIntersectionNotFound) {
+		t.Fatalf("got %v; want ErrIntersectionNotFound", err)
+	}
+}
+
+// recordingStore records every point saved
+type recordingStore struct {
+	mutex sync.Mutex
+	saved []string
+}
+
+func (r *recordingStore) Save(_ context.Context, p chainsync.Point) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.saved = append(r.saved, p.String())
+	return nil
+}
+
+func (r *recordingStore) Load(context.Context) (chainsync.Points, error) {
+	return nil, nil
+}
+
+func testBlock(height uint64, id string) chainsync.Block {
+	return chainsync.Block{
+		Type:   "praos",
+		Era:    "babbage",
+		ID:     id,
+		Height: height,
+		Slot:   height * 10,
+	}
+}
+
+func TestClient_ChainSyncConfirmations(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	server := ogmiostest.NewServer()
+	defer server.Close()
+
+	b1 := testBlock(1, "a")
+	server.RollForward(b1, testBlock(2, "b"), testBlock(3, "c"))
+	server.RollBackward(b1.PointStruct().Point())
+	server.RollForward(testBlock(2, "b'"), testBlock(3, "c'"), testBlock(4, "d'"))
+
+	client := New(WithEndpoint(server.URL), WithLogger(NopLogger), WithInterval(1))
+	defer client.Close()
+
+	var (
+		got   []string
+		done  = make(chan struct{})
+		store = &recordingStore{}
+	)
+	callback := func(ctx context.Context, data []byte) error {
+		msg := &syncMessage{data: data}
+		nbr, ok := msg.nextBlock()
+		if !ok {
+			return nil
+		}
+		switch nbr.Direction {
+		case chainsync.RollForwardString:
+			got = append(got, "forward:"+nbr.Block.ID)
+			if nbr.Block.ID == "b'" {
+				close(done)
+			}
+		case chainsync.RollBackwardString:
+			got = append(got, "backward:"+nbr.Point.String())
+		}
+		return nil
+	}
+
+	closer, err := client.ChainSync(ctx, callback, WithConfirmations(2), WithStore(store))
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatalf("got %v; want forward:b'", got)
+	case <-done:
+	}
+	_ = closer.Close()
+	<-closer.Done()
+
+	want := []string{"backward:origin", "forward:a", "forward:b'"}
+	assert.EqualValues(t, want, got)
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	for _, saved := range store.saved {
+		switch saved {
+		case "origin", "slot=10 id=a block=1", "slot=20 id=b' block=2":
+		default:
+			t.Fatalf("got %v; want only delivered points saved", saved)
+		}
+	}
+}
+
+func TestClient_ChainSyncInterval(t *testing.T) {
+	point := func(height int) string {
+		return fmt.Sprintf("slot=%v id=block block=%v", height*10, height)
+	}
+
+	// points are saved every third message delivered, the intersection
+	// being the first
+	tests := map[string]struct {
+		opts      []ChainSyncOption
+		delivered int
+		want      []string
+	}{
+		"confirmations": {
+			opts:      []ChainSyncOption{WithConfirmations(2)},
+			delivered: 9, // all but the two blocks awaiting confirmation
+			want:      []string{point(2), point(5), point(8)},
+		},
+		"min slot": {
+			opts:      []ChainSyncOption{WithMinSlot(30)},
+			delivered: 9, // all but the first two blocks
+			want:      []string{point(4), point(7), point(10)},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			client := New(
+				WithTransport(NewMemoryTransport(memoryOgmios(10))),
+				WithLogger(NopLogger),
+				WithInterval(3),
+			)
+			defer client.Close()
+
+			var (
+				delivered int
+				done      = make(chan struct{})
+				store     = &recordingStore{}
+			)
+			callback := func(ctx context.Context, data []byte) error {
+				if delivered++; delivered == tc.delivered {
+					close(done)
+				}
+				return nil
+			}
+			closer, err := client.ChainSync(ctx, callback, append(tc.opts, WithStore(store))...)
+			if err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			select {
+			case <-ctx.Done():
+				t.Fatalf("got %v; want %v messages", ctx.Err(), tc.delivered)
+			case <-done:
+			}
+			_ = closer.Close()
+			<-closer.Done()
+
+			// closing saves a further, older, point
+			store.mutex.Lock()
+			defer store.mutex.Unlock()
+			if len(store.saved) < len(tc.want) {
+				t.Fatalf("got %v; want %v", store.saved, tc.want)
+			}
+			if got := store.saved[:len(tc.want)]; !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestConfirmations_push(t *testing.T) {
+	forward := func(height uint64, id string) *syncMessage {
+		data, _ := json.Marshal(Map{
+			"jsonrpc": "2.0",
+			"method":  chainsync.NextBlockMethod,
+			"result":  Map{"direction": chainsync.RollForwardString, "block": testBlock(height, id)},
+		})
+		return &syncMessage{data: data}
+	}
+	backward := func(height uint64, id string) *syncMessage {
+		data, _ := json.Marshal(Map{
+			"jsonrpc": "2.0",
+			"method":  chainsync.NextBlockMethod,
+			"result": Map{
+				"direction": chainsync.RollBackwardString,
+				"point":     testBlock(height, id).PointStruct().Point(),
+			},
+		})
+		return &syncMessage{data: data}
+	}
+	ids := func(msgs []*syncMessage) (ids []string) {
+		for _, msg := range msgs {
+			point, _ := msg.point()
+			ps, _ := point.PointStruct()
+			ids = append(ids, ps.ID)
+		}
+		return ids
+	}
+
+	t.Run("settles after depth", func(t *testing.T) {
+		c := newConfirmations(2, nil)
+		if got := c.push(forward(1, "a")); len(got) != 0 {
+			t.Fatalf("got %v; want none", ids(got))
+		}
+		if got := c.push(forward(2, "b")); len(got) != 0 {
+			t.Fatalf("got %v; want none", ids(got))
+		}
+		assert.EqualValues(t, []string{"a"}, ids(c.push(forward(3, "c"))))
+	})
+
+	t.Run("rollback inside buffer", func(t *testing.T) {
+		c := newConfirmations(2, nil)
+		c.push(forward(1, "a"))
+		c.push(forward(2, "b"))
+		if got := c.push(backward(1, "a")); len(got) != 0 {
+			t.Fatalf("got %v; want none", ids(got))
+		}
+		if got := c.push(forward(2, "b'")); len(got) != 0 {
+			t.Fatalf("got %v; want none", ids(got))
+		}
+		assert.EqualValues(t, []string{"a"}, ids(c.push(forward(3, "c'"))))
+	})
+
+	t.Run("rollback beyond buffer", func(t *testing.T) {
+		c := newConfirmations(1, nil)
+		c.push(forward(1, "a"))
+		c.push(forward(2, "b"))
+		c.push(forward(3, "c")) // settles b
+		assert.EqualValues(t, []string{"a"}, ids(c.push(backward(1, "a"))))
+		if got := c.push(forward(2, "b'")); len(got) != 0 {
+			t.Fatalf("got %v; want none", ids(got))
+		}
+	})
+
+	t.Run("resume after delivered", func(t *testing.T) {
+		c := newConfirmations(1, []*syncMessage{forward(1, "a"), forward(2, "b")})
+		if got := c.push(backward(2, "b")); len(got) != 0 {
+			t.Fatalf("got %v; want none", ids(got))
+		}
+	})
+}
+
+func TestClient_ChainSyncDecodeWorkers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := New(
+		WithTransport(NewMemoryTransport(memoryOgmios(100))),
+		WithLogger(NopLogger),
+		WithPipeline(50),
+	)
+	defer client.Close()
+
+	store := &recordingStore{}
+	handler := &handlerRecorder{done: make(chan struct{}), want: 100}
+	closer, err := client.ChainSyncWithHandler(ctx, handler, WithDecodeWorkers(4), WithStore(store))
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	select {
+	case <-ctx.Done():
+		t.Fatalf("got %v blocks; want %v", len(handler.blocks), handler.want)
+	case <-handler.done:
+	}
+	_ = closer.Close()
+	<-closer.Done()
+
+	for i, block := range handler.blocks {
+		if got, want := block.Height, uint64(i+1); got != want {
+			t.Fatalf("got block %v; want %v", got, want)
+		}
+	}
+
+	// the final save records the oldest of the last three delivered blocks
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if len(store.saved) == 0 {
+		t.Fatalf("got no saved points; want at least 1")
+	}
+	if got, want := store.saved[len(store.saved)-1], "slot=980 id=block block=98"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
+
+// memoryChainSyncReplay answers every nextBlock with the recorded block
+func memoryChainSyncReplay(block []byte) MemoryHandler {
+	return func(ctx context.Context, conn Conn) {
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			response := block
+			if method, _ := jsonparser.GetString(data, "method"); method == chainsync.FindIntersectionMethod {
+				response = []byte(`{"jsonrpc":"2.0","method":"findIntersection","result":{"intersection":"origin","tip":{"slot":0,"id":"tip","height":0}}}`)
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, response); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// countingHandler signals done once want blocks have rolled forward
+type countingHandler struct {
+	n    int
+	want int
+	done chan struct{}
+}
+
+func (h *countingHandler) OnIntersection(context.Context, chainsync.Point, chainsync.PointStruct) error {
+	return nil
+}
+
+func (h *countingHandler) OnRollForward(context.Context, *chainsync.Block, chainsync.PointStruct) error {
+	if h.n++; h.n == h.want {
+		close(h.done)
+	}
+	return nil
+}
+
+func (h *countingHandler) OnRollBackward(context.Context, chainsync.Point, chainsync.PointStruct) error {
+	return nil
+}
+
+func BenchmarkClient_ChainSyncWithHandler(b *testing.B) {
+	for _, filename := range []string{"Response_NextBlock_v6.json", "RollForward_v6.json"} {
+		block, err := os.ReadFile("ouroboros/chainsync/compatibility/test_data/" + filename)
+		if err != nil {
+			b.Fatalf("got %v; want nil", err)
+		}
+		if _, err := jsonparser.GetString(block, "method"); err != nil {
+			// the fixture holds the nextBlock result alone
+			block = append(append([]byte(`{"jsonrpc":"2.0","method":"nextBlock","result":`), block...), '}')
+		}
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, block); err != nil {
+			b.Fatalf("got %v; want nil", err)
+		}
+		block = buf.Bytes()
+
+		for _, workers := range []int{0, 1, 2, 4, 8} {
+			b.Run(fmt.Sprintf("%v/workers=%v", filename, workers), func(b *testing.B) {
+				client := New(
+					WithTransport(NewMemoryTransport(memoryChainSyncReplay(block))),
+					WithLogger(NopLogger),
+					WithPipeline(50),
+				)
+				defer client.Close()
+
+				handler := &countingHandler{want: b.N, done: make(chan struct{})}
+				b.SetBytes(int64(len(block)))
+				b.ResetTimer()
+
+				closer, err := client.ChainSyncWithHandler(context.Background(), handler, WithDecodeWorkers(workers))
+				if err != nil {
+					b.Fatalf("got %v; want nil", err)
+				}
+				select {
+				case <-handler.done:
+				case err := <-closer.Err():
+					b.Fatalf("got %v; want nil", err)
+				}
+				b.StopTimer()
+				_ = closer.Close()
+				<-closer.Done()
+			})
+		}
+	}
+}
+
+func TestClient_ChainSyncStop(t *testing.T) {
+	tests := map[string]struct {
+		opts    []ChainSyncOption
+		want    uint64 // slot of the final block delivered
+		wantErr bool
+	}{
+		"max slot": {
+			opts: []ChainSyncOption{WithMaxSlot(55)},
+			want: 50,
+		},
+		"max slot of a block": {
+			opts: []ChainSyncOption{WithMaxSlot(50)},
+			want: 50,
+		},
+		"stop point": {
+			opts: []ChainSyncOption{WithStopPoint(chainsync.PointStruct{Slot: 30, ID: "block"}.Point())},
+			want: 30,
+		},
+		"stop point with decode workers": {
+			opts: []ChainSyncOption{WithStopPoint(chainsync.PointStruct{Slot: 30, ID: "block"}.Point()), WithDecodeWorkers(2)},
+			want: 30,
+		},
+		"stop point not on chain": {
+			opts:    []ChainSyncOption{WithStopPoint(chainsync.PointStruct{Slot: 30, ID: "fork"}.Point())},
+			want:    20,
+			wantErr: true,
+		},
+		"stop point between blocks": {
+			opts:    []ChainSyncOption{WithStopPoint(chainsync.PointStruct{Slot: 35, ID: "block"}.Point())},
+			want:    30,
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			client := New(
+				WithTransport(NewMemoryTransport(memoryOgmios(10))),
+				WithLogger(NopLogger),
+			)
+			defer client.Close()
+
+			store := &recordingStore{}
+			handler := &handlerRecorder{done: make(chan struct{})}
+			closer, err := client.ChainSyncWithHandler(ctx, handler, append(tc.opts, WithStore(store))...)
+			if err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				t.Fatalf("got %v; want chainsync completed", ctx.Err())
+			case <-closer.Done():
+			}
+			if err := <-closer.Err(); (err != nil) != tc.wantErr {
+				t.Fatalf("got %v; want err %v", err, tc.wantErr)
+			}
+
+			if len(handler.blocks) == 0 {
+				t.Fatalf("got no blocks; want slot %v", tc.want)
+			}
+			if got := handler.blocks[len(handler.blocks)-1].Slot; got != tc.want {
+				t.Fatalf("got %v; want %v", got, tc.want)
+			}
+			if tc.wantErr {
+				return
+			}
+
+			// the final checkpoint covers the final block
+			store.mutex.Lock()
+			defer store.mutex.Unlock()
+			if len(store.saved) == 0 {
+				t.Fatalf("got no saved points; want at least 1")
+			}
+			if got, want := store.saved[len(store.saved)-1], fmt.Sprintf("slot=%v id=block block=%v", tc.want, tc.want/10); got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+}
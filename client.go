@@ -14,10 +14,18 @@
 
 package ogmigo
 
+import (
+	"context"
+)
+
 // Client provides a client for the chain sync protocol only
 type Client struct {
-	logger  Logger
-	options Options
+	logger    Logger
+	options   Options
+	endpoints *endpointSelector
+	requestID uint64
+	version   int32 // Version of the server, once detected
+	cancel    context.CancelFunc
 }
 
 // New returns a new Client
@@ -25,8 +33,26 @@ func New(opts ...Option) *Client {
 	options := buildOptions(opts...)
 	logger := options.logger.With(KV("service", "ogmios"))
 
-	return &Client{
+	client := &Client{
 		logger:  logger,
 		options: options,
 	}
+	client.endpoints = newEndpointSelector(client, options.endpoints, options.maxLag)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client.cancel = cancel
+	if len(options.endpoints) > 1 && options.healthInterval > 0 {
+		go client.checkHealth(ctx, options.healthInterval)
+	}
+
+	return client
+}
+
+// Close releases the persistent connections used for queries and stops any
+// endpoint health checks.  Active ChainSync and MonitorMempool sessions are
+// unaffected and must be closed separately.
+func (c *Client) Close() error {
+	c.cancel()
+	c.endpoints.close()
+	return nil
 }
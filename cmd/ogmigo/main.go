@@ -16,7 +16,6 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
 	"os"
@@ -93,30 +92,7 @@ func action(_ *cli.Context) error {
 		}.Point())
 	}
 
-	var counter int64
-	var callback ogmigo.ChainSyncFunc = func(ctx context.Context, data []byte) error {
-		if v := atomic.AddInt64(&counter, 1); v%opts.Tick != 0 {
-			return nil
-		}
-
-		var response chainsync.ResponsePraos
-		if err := json.Unmarshal(data, &response); err != nil {
-			return err
-		}
-		if response.Result == nil {
-			return nil
-		}
-		intersect := response.Result.(chainsync.ResultFindIntersectionPraos).Intersection
-		if intersect == nil {
-			return nil
-		}
-
-		ps, _ := intersect.PointStruct()
-		fmt.Printf("slot=%v id=%v block=%v\n", ps.Slot, ps.ID, ps.Height)
-
-		return nil
-	}
-	closer, err := client.ChainSync(ctx, callback,
+	closer, err := client.ChainSyncWithHandler(ctx, &printer{},
 		ogmigo.WithPoints(points...),
 		ogmigo.WithReconnect(true),
 	)
@@ -133,3 +109,26 @@ func action(_ *cli.Context) error {
 
 	return nil
 }
+
+// printer displays progress every tick blocks
+type printer struct {
+	counter int64
+}
+
+func (p *printer) OnIntersection(_ context.Context, point chainsync.Point, _ chainsync.PointStruct) error {
+	fmt.Printf("intersection=%v\n", point)
+	return nil
+}
+
+func (p *printer) OnRollForward(_ context.Context, block *chainsync.Block, _ chainsync.PointStruct) error {
+	if v := atomic.AddInt64(&p.counter, 1); v%opts.Tick != 0 {
+		return nil
+	}
+	fmt.Printf("slot=%v id=%v block=%v\n", block.Slot, block.ID, block.Height)
+	return nil
+}
+
+func (p *printer) OnRollBackward(_ context.Context, point chainsync.Point, _ chainsync.PointStruct) error {
+	fmt.Printf("rollback=%v\n", point)
+	return nil
+}
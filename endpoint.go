@@ -0,0 +1,197 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogmigo
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// maxEndpointBackoff caps how long an endpoint is skipped after repeated
+	// connect failures
+	maxEndpointBackoff = time.Minute
+)
+
+// endpoint tracks the health of a single ogmios endpoint.  All fields other
+// than url and pool are guarded by the selector mutex.
+type endpoint struct {
+	url  string
+	pool *connPool
+
+	failures    int           // consecutive connect failures
+	retryAt     time.Time     // skip the endpoint until then after a failure
+	latency     time.Duration // moving average of request latency
+	tip         uint64        // slot of the most recently observed tip
+	quarantined bool          // too far behind the best known tip
+}
+
+// available returns true if the endpoint should be preferred for new requests
+func (e *endpoint) available(now time.Time) bool {
+	return !e.quarantined && !now.Before(e.retryAt)
+}
+
+// endpointSelector chooses the healthiest endpoint for each connection
+type endpointSelector struct {
+	logger Logger
+	maxLag uint64 // slots behind the best tip before quarantine
+
+	mutex     sync.Mutex
+	endpoints []*endpoint
+}
+
+func newEndpointSelector(client *Client, urls []string, maxLag uint64) *endpointSelector {
+	s := &endpointSelector{
+		logger: client.logger,
+		maxLag: maxLag,
+	}
+	for _, url := range urls {
+		s.endpoints = append(s.endpoints, &endpoint{
+			url:  url,
+			pool: newConnPool(client, url, client.options.queryConns),
+		})
+	}
+	return s
+}
+
+// order returns all endpoints, healthiest first
+func (s *endpointSelector) order() []*endpoint {
+	now := time.Now()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	endpoints := append([]*endpoint(nil), s.endpoints...)
+	sort.SliceStable(endpoints, func(i, j int) bool {
+		a, b := endpoints[i], endpoints[j]
+		if aa, ba := a.available(now), b.available(now); aa != ba {
+			return aa
+		}
+		if a.failures != b.failures {
+			return a.failures < b.failures
+		}
+		return a.latency < b.latency
+	})
+	return endpoints
+}
+
+// failed records a connect failure, backing off the endpoint exponentially
+func (s *endpointSelector) failed(e *endpoint) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e.failures++
+	backoff := time.Second << uint(e.failures-1)
+	if backoff > maxEndpointBackoff || backoff <= 0 {
+		backoff = maxEndpointBackoff
+	}
+	e.retryAt = time.Now().Add(backoff)
+}
+
+// succeeded records a successful request along with its latency
+func (s *endpointSelector) succeeded(e *endpoint, latency time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e.failures = 0
+	e.retryAt = time.Time{}
+	if latency > 0 {
+		if e.latency == 0 {
+			e.latency = latency
+		} else {
+			e.latency = (e.latency*4 + latency) / 5
+		}
+	}
+}
+
+// observeTip records the tip reported by the endpoint and quarantines any
+// endpoint lagging too far behind the best tip
+func (s *endpointSelector) observeTip(e *endpoint, slot uint64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e.tip = slot
+
+	var best uint64
+	for _, e := range s.endpoints {
+		if e.tip > best {
+			best = e.tip
+		}
+	}
+	for _, e := range s.endpoints {
+		quarantined := e.tip > 0 && best-e.tip > s.maxLag
+		if quarantined != e.quarantined {
+			s.logger.Info("ogmios endpoint health changed",
+				KV("endpoint", redact(e.url)),
+				KV("quarantined", strconv.FormatBool(quarantined)),
+				KV("lag", strconv.FormatUint(best-e.tip, 10)),
+			)
+		}
+		e.quarantined = quarantined
+	}
+}
+
+// close releases the pooled connections of every endpoint
+func (s *endpointSelector) close() {
+	for _, e := range s.endpoints {
+		e.pool.close()
+	}
+}
+
+// checkHealth periodically queries the tip of every endpoint until the
+// context is done
+func (c *Client) checkHealth(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for _, e := range c.endpoints.order() {
+			c.probe(ctx, e, interval)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Client) probe(ctx context.Context, e *endpoint, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var content struct{ Result struct{ Slot uint64 } }
+	query := func(payload Map) func(context.Context) error {
+		return func(ctx context.Context) error {
+			return c.queryEndpoint(ctx, e, payload, &content)
+		}
+	}
+	err := c.dispatch(ctx,
+		query(makePayload("queryLedgerState/tip", Map{}, nil)),
+		query(makePayloadV5("Query", Map{"query": "ledgerTip"})),
+	)
+	if err != nil {
+		c.logger.Debug("ogmios health check failed",
+			KV("endpoint", redact(e.url)),
+			KV("err", err.Error()),
+		)
+		return
+	}
+	c.endpoints.observeTip(e, content.Result.Slot)
+}
@@ -0,0 +1,155 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogmigo
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// routedTransport dials a different Transport per endpoint
+type routedTransport map[string]Transport
+
+func (r routedTransport) Dial(ctx context.Context, endpoint string) (Conn, error) {
+	transport, ok := r[endpoint]
+	if !ok {
+		return nil, fmt.Errorf("unknown endpoint, %v", endpoint)
+	}
+	return transport.Dial(ctx, endpoint)
+}
+
+func TestEndpointSelector_order(t *testing.T) {
+	client := New(
+		WithEndpoints("a", "b", "c"),
+		WithHealthCheck(0, 100),
+		WithLogger(NopLogger),
+	)
+	defer client.Close()
+
+	s := client.endpoints
+	a, b, c := s.endpoints[0], s.endpoints[1], s.endpoints[2]
+
+	urls := func() (got []string) {
+		for _, e := range s.order() {
+			got = append(got, e.url)
+		}
+		return got
+	}
+
+	s.succeeded(a, 30*time.Millisecond)
+	s.succeeded(b, 10*time.Millisecond)
+	s.succeeded(c, 20*time.Millisecond)
+	if got, want := fmt.Sprint(urls()), "[b c a]"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+
+	s.failed(b)
+	if got, want := fmt.Sprint(urls()), "[c a b]"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+
+	s.observeTip(a, 1000)
+	s.observeTip(c, 500)
+	if !c.quarantined {
+		t.Fatalf("got false; want lagging endpoint quarantined")
+	}
+	if got, want := fmt.Sprint(urls()), "[a c b]"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+
+	s.observeTip(c, 1000)
+	if c.quarantined {
+		t.Fatalf("got true; want endpoint released once caught up")
+	}
+}
+
+func TestClient_WithEndpoints(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	t.Run("failover", func(t *testing.T) {
+		client := New(
+			WithEndpoints("down", "up"),
+			WithTransport(routedTransport{
+				"down": &flakyTransport{failures: 1000},
+				"up":   NewMemoryTransport(memoryOgmios(10)),
+			}),
+			WithLogger(NopLogger),
+		)
+		defer client.Close()
+
+		tip, err := client.ChainTip(ctx)
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if ps, _ := tip.PointStruct(); ps == nil || ps.Slot != 100 {
+			t.Fatalf("got %#v; want slot 100", tip)
+		}
+
+		received := make(chan struct{})
+		callback := func(context.Context, []byte) error {
+			select {
+			case received <- struct{}{}:
+			default:
+			}
+			return nil
+		}
+		closer, err := client.ChainSync(ctx, callback)
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		defer closer.Close()
+
+		select {
+		case <-received:
+		case <-ctx.Done():
+			t.Fatalf("got timeout; want chainsync via healthy endpoint")
+		}
+	})
+
+	t.Run("quarantine", func(t *testing.T) {
+		client := New(
+			WithEndpoints("behind", "ahead"),
+			WithTransport(routedTransport{
+				"behind": NewMemoryTransport(memoryOgmios(1)),
+				"ahead":  NewMemoryTransport(memoryOgmios(1000)),
+			}),
+			WithHealthCheck(10*time.Millisecond, 100),
+			WithLogger(NopLogger),
+		)
+		defer client.Close()
+
+		for {
+			if e := client.endpoints.order()[0]; e.url == "ahead" {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				t.Fatalf("got timeout; want lagging endpoint quarantined")
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+
+		tip, err := client.ChainTip(ctx)
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if ps, _ := tip.PointStruct(); ps == nil || ps.Slot != 10000 {
+			t.Fatalf("got %#v; want slot 10000", tip)
+		}
+	})
+}
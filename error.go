@@ -15,7 +15,12 @@
 package ogmigo
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync"
+	"github.com/buger/jsonparser"
 )
 
 // Error encapsulates errors from ogmios
@@ -34,3 +39,114 @@ type Fault struct {
 	Code   string `json:"code,omitempty"`   // Code identifies error
 	String string `json:"string,omitempty"` // String provides human readable description
 }
+
+// Sentinel errors for the documented ogmios error families.  Use errors.Is
+// against an error returned by the client e.g.
+//
+//	if errors.Is(err, ogmigo.ErrUnavailableInEra) { ... }
+var (
+	ErrInvalidRequest          = errors.New("ogmios: invalid json-rpc request")
+	ErrIntersectionNotFound    = errors.New("ogmios: intersection not found")
+	ErrIntersectionInterleaved = errors.New("ogmios: intersection interleaved")
+	ErrAcquireFailed           = errors.New("ogmios: failed to acquire ledger state")
+	ErrEraMismatch             = errors.New("ogmios: query era mismatch")
+	ErrUnavailableInEra        = errors.New("ogmios: query unavailable in current era")
+	ErrAcquiredExpired         = errors.New("ogmios: acquired ledger state expired")
+	ErrSubmissionRejected      = errors.New("ogmios: transaction submission rejected")
+	ErrEvaluationFailed        = errors.New("ogmios: transaction evaluation failed")
+	ErrMempoolNotAcquired      = errors.New("ogmios: mempool must be acquired first")
+)
+
+// errorFamily maps a range of ogmios error codes to a sentinel error.  As
+// codes are reused across mini-protocols, methods optionally restricts the
+// family to errors returned by the named methods.
+type errorFamily struct {
+	err      error
+	min, max int
+	methods  []string
+}
+
+var errorFamilies = []errorFamily{
+	{err: ErrInvalidRequest, min: -32700, max: -32600},
+	{err: ErrIntersectionNotFound, min: 1000, max: 1000},
+	{err: ErrIntersectionInterleaved, min: 1001, max: 1001},
+	{err: ErrAcquireFailed, min: 2000, max: 2000},
+	{err: ErrEraMismatch, min: 2001, max: 2001},
+	{err: ErrUnavailableInEra, min: 2002, max: 2002},
+	{err: ErrAcquiredExpired, min: 2003, max: 2003},
+	{err: ErrSubmissionRejected, min: 3000, max: 3999, methods: []string{"submitTransaction"}},
+	{err: ErrEvaluationFailed, min: 3000, max: 3999, methods: []string{"evaluateTransaction"}},
+	{err: ErrMempoolNotAcquired, min: 4000, max: 4000},
+}
+
+func (f errorFamily) matches(e *RPCError) bool {
+	if e.Code < f.min || e.Code > f.max {
+		return false
+	}
+	if len(f.methods) == 0 {
+		return true
+	}
+	for _, method := range f.methods {
+		if method == e.Method {
+			return true
+		}
+	}
+	return false
+}
+
+// RPCError encapsulates a JSON-RPC error returned by ogmios v6.  Data holds
+// the error specific details, which vary by Code; see
+// https://ogmios.dev/api/ for the documented codes.
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Method  string          `json:"-"` // Method that returned the error, when known
+}
+
+// Error implements error interface
+func (e *RPCError) Error() string {
+	if e.Method != "" {
+		return fmt.Sprintf("%v failed, %v: %v", e.Method, e.Code, e.Message)
+	}
+	return fmt.Sprintf("%v: %v", e.Code, e.Message)
+}
+
+// Is reports whether the error belongs to the family of the sentinel target
+func (e *RPCError) Is(target error) bool {
+	for _, f := range errorFamilies {
+		if f.err == target {
+			return f.matches(e)
+		}
+	}
+	return false
+}
+
+// FromResultError converts a chainsync.ResultError returned by method into
+// an RPCError
+func FromResultError(method string, e *chainsync.ResultError) *RPCError {
+	if e == nil {
+		return nil
+	}
+	return &RPCError{
+		Code:    int(int32(e.Code)),
+		Message: e.Message,
+		Data:    e.Data,
+		Method:  method,
+	}
+}
+
+// readRPCError returns the RPCError carried by a JSON-RPC response, if any
+func readRPCError(raw []byte) (*RPCError, bool, error) {
+	value, dataType, _, err := jsonparser.Get(raw, "error")
+	if err != nil || dataType != jsonparser.Object {
+		return nil, false, nil
+	}
+
+	var e RPCError
+	if err := json.Unmarshal(value, &e); err != nil {
+		return nil, false, fmt.Errorf("failed to decode error: %w", err)
+	}
+	e.Method, _ = jsonparser.GetString(raw, "method")
+	return &e, true, nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogmigo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync"
+)
+
+func TestRPCError_Is(t *testing.T) {
+	tests := map[string]struct {
+		Err  error
+		Want error
+		Not  error
+	}{
+		"intersection": {
+			Err:  &RPCError{Code: 1000, Method: "findIntersection"},
+			Want: ErrIntersectionNotFound,
+			Not:  ErrIntersectionInterleaved,
+		},
+		"era": {
+			Err:  fmt.Errorf("failed to query: %w", &RPCError{Code: 2002}),
+			Want: ErrUnavailableInEra,
+			Not:  ErrEraMismatch,
+		},
+		"era mismatch": {
+			Err:  &RPCError{Code: 2001, Method: "queryLedgerState/utxo"},
+			Want: ErrEraMismatch,
+			Not:  ErrUnavailableInEra,
+		},
+		"acquired expired": {
+			Err:  &RPCError{Code: 2003},
+			Want: ErrAcquiredExpired,
+			Not:  ErrUnavailableInEra,
+		},
+		"submit": {
+			Err:  &RPCError{Code: 3005, Method: "submitTransaction"},
+			Want: ErrSubmissionRejected,
+			Not:  ErrEvaluationFailed,
+		},
+		"evaluate": {
+			Err:  &RPCError{Code: 3010, Method: "evaluateTransaction"},
+			Want: ErrEvaluationFailed,
+			Not:  ErrSubmissionRejected,
+		},
+		"json-rpc": {
+			Err:  &RPCError{Code: -32602},
+			Want: ErrInvalidRequest,
+			Not:  ErrMempoolNotAcquired,
+		},
+		"result error": {
+			Err:  FromResultError(chainsync.FindIntersectionMethod, &chainsync.ResultError{Code: 1001}),
+			Want: ErrIntersectionInterleaved,
+			Not:  ErrIntersectionNotFound,
+		},
+	}
+
+	for label, tc := range tests {
+		t.Run(label, func(t *testing.T) {
+			if !errors.Is(tc.Err, tc.Want) {
+				t.Fatalf("got false; want %v to match %v", tc.Err, tc.Want)
+			}
+			if errors.Is(tc.Err, tc.Not) {
+				t.Fatalf("got true; want %v not to match %v", tc.Err, tc.Not)
+			}
+		})
+	}
+}
+
+func TestClient_queryRPCError(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var connections int64
+	server := httptest.NewServer(rpcHandler(&connections, func(method string, _ json.RawMessage) (interface{}, Map) {
+		switch method {
+		case "submitTransaction":
+			return nil, Map{"code": 3117, "message": "unknown inputs", "data": Map{"unknownOutputReferences": []string{}}}
+		default:
+			return nil, Map{"code": 2002, "message": "unavailable in current era"}
+		}
+	}))
+	defer server.Close()
+
+	client := New(
+		WithEndpoint("ws"+strings.TrimPrefix(server.URL, "http")),
+		WithLogger(NopLogger),
+	)
+	defer client.Close()
+
+	_, err := client.CurrentEpoch(ctx)
+	var e *RPCError
+	if !errors.As(err, &e) {
+		t.Fatalf("got %v; want *RPCError", err)
+	}
+	if got, want := e.Code, 2002; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if !errors.Is(err, ErrUnavailableInEra) {
+		t.Fatalf("got %v; want ErrUnavailableInEra", err)
+	}
+
+	response, err := client.SubmitTx(ctx, "deadbeef")
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if response.Error == nil {
+		t.Fatalf("got nil; want submit error")
+	}
+	if !errors.Is(response.Error, ErrSubmissionRejected) {
+		t.Fatalf("got %v; want ErrSubmissionRejected", response.Error)
+	}
+	if got, want := string(response.Error.Data), `{"unknownOutputReferences":[]}`; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
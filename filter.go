@@ -0,0 +1,237 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogmigo
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync"
+	"github.com/buger/jsonparser"
+)
+
+// TxFilter reports whether a json encoded transaction, as sent by ogmios,
+// should be delivered; see WithFilter.  The filters provided by this package
+// scan the json with jsonparser rather than decoding it.
+type TxFilter func(tx []byte) bool
+
+// WithFilter delivers only the transactions matched by at least one of the
+// filters.  Blocks are still delivered in full, less the transactions that
+// did not match, so checkpoints and rollbacks are unaffected.  Filters from
+// repeated WithFilter options are combined.
+func WithFilter(filters ...TxFilter) ChainSyncOption {
+	return func(opts *ChainSyncOptions) {
+		opts.filters = append(opts.filters, filters...)
+	}
+}
+
+// FilterAddress matches transactions that pay to any of the addresses.
+// Inputs reference outputs by id alone, so spending from an address is not
+// matched.
+func FilterAddress(addresses ...string) TxFilter {
+	want := stringSet(addresses)
+	return func(tx []byte) (ok bool) {
+		eachOutput(tx, func(output []byte) bool {
+			address, _ := jsonparser.GetString(output, "address")
+			_, ok = want[address]
+			return ok
+		})
+		return ok
+	}
+}
+
+// FilterPaymentCredential matches transactions that pay to an address whose
+// payment part is any of the hex encoded key or script hashes, regardless of
+// the stake part of the address
+func FilterPaymentCredential(credentials ...string) TxFilter {
+	var want [][]byte
+	for _, credential := range credentials {
+		if data, err := hex.DecodeString(credential); err == nil {
+			want = append(want, data)
+		}
+	}
+	return func(tx []byte) (ok bool) {
+		eachOutput(tx, func(output []byte) bool {
+			address, _ := jsonparser.GetString(output, "address")
+			credential, found := paymentCredential(address)
+			if !found {
+				return false
+			}
+			for _, w := range want {
+				if bytes.Equal(w, credential) {
+					ok = true
+					return true
+				}
+			}
+			return false
+		})
+		return ok
+	}
+}
+
+// FilterPolicyID matches transactions that mint, burn or pay assets of any of
+// the policies
+func FilterPolicyID(policies ...string) TxFilter {
+	want := stringSet(policies)
+	return func(tx []byte) (ok bool) {
+		hasPolicy := func(key []byte, _ []byte, _ jsonparser.ValueType, _ int) error {
+			if _, found := want[string(key)]; found {
+				ok = true
+			}
+			return nil
+		}
+		_ = jsonparser.ObjectEach(tx, hasPolicy, "mint")
+		if ok {
+			return true
+		}
+		eachOutput(tx, func(output []byte) bool {
+			_ = jsonparser.ObjectEach(output, hasPolicy, "value")
+			return ok
+		})
+		return ok
+	}
+}
+
+// FilterTxID matches the transactions with any of the ids
+func FilterTxID(ids ...string) TxFilter {
+	want := stringSet(ids)
+	return func(tx []byte) bool {
+		id, _ := jsonparser.GetString(tx, "id")
+		_, ok := want[id]
+		return ok
+	}
+}
+
+// FilterMetadataLabel matches transactions carrying metadata under any of
+// the labels
+func FilterMetadataLabel(labels ...uint64) TxFilter {
+	want := map[string]struct{}{}
+	for _, label := range labels {
+		want[strconv.FormatUint(label, 10)] = struct{}{}
+	}
+	return func(tx []byte) (ok bool) {
+		_ = jsonparser.ObjectEach(tx, func(key []byte, _ []byte, _ jsonparser.ValueType, _ int) error {
+			if _, found := want[string(key)]; found {
+				ok = true
+			}
+			return nil
+		}, "metadata", "labels")
+		return ok
+	}
+}
+
+// filterBlock removes the transactions matched by none of the filters from
+// a nextBlock response.  The response is returned as is when all of its
+// transactions match or it carries no block.
+func filterBlock(data []byte, filters []TxFilter) ([]byte, error) {
+	if direction, _ := jsonparser.GetString(data, "result", "direction"); direction != chainsync.RollForwardString {
+		return data, nil
+	}
+
+	var (
+		matched [][]byte
+		total   int
+	)
+	_, err := jsonparser.ArrayEach(data, func(tx []byte, _ jsonparser.ValueType, _ int, _ error) {
+		total++
+		for _, filter := range filters {
+			if filter(tx) {
+				matched = append(matched, tx)
+				return
+			}
+		}
+	}, "result", "block", "transactions")
+	if err == jsonparser.KeyPathNotFoundError || len(matched) == total {
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	txs := append([]byte{'['}, bytes.Join(matched, []byte{','})...)
+	txs = append(txs, ']')
+	return jsonparser.Set(data, txs, "result", "block", "transactions")
+}
+
+// eachOutput calls fn with each output of the transaction until fn returns
+// true
+func eachOutput(tx []byte, fn func(output []byte) bool) {
+	var done bool
+	_, _ = jsonparser.ArrayEach(tx, func(output []byte, _ jsonparser.ValueType, _ int, _ error) {
+		if !done {
+			done = fn(output)
+		}
+	}, "outputs")
+}
+
+// bech32Charset maps each bech32 character to its 5 bit value
+var bech32Charset = func() (m [128]int8) {
+	for i := range m {
+		m[i] = -1
+	}
+	for i, c := range "qpzry9x8gf2tvdw0s3jn54khce6mua7l" {
+		m[c] = int8(i)
+	}
+	return m
+}()
+
+// paymentCredential returns the payment key or script hash of a shelley
+// address.  The checksum is not verified; the address comes from ogmios.
+// bech32.Decode is not used as it rejects strings longer than 90 characters,
+// which includes every base address.
+func paymentCredential(address string) ([]byte, bool) {
+	// byron addresses are base58 encoded
+	sep := strings.LastIndexByte(address, '1')
+	if !strings.HasPrefix(address, "addr") || sep < 1 || len(address)-sep < 7 {
+		return nil, false
+	}
+
+	const credentialSize = 28
+	var (
+		data = make([]byte, 0, 1+credentialSize)
+		acc  uint
+		bits uint
+	)
+	for _, c := range address[sep+1 : len(address)-6] {
+		if c >= 128 || bech32Charset[c] < 0 {
+			return nil, false
+		}
+		acc = (acc<<5 | uint(bech32Charset[c])) & 0xfff
+		bits += 5
+		if bits >= 8 {
+			bits -= 8
+			data = append(data, byte(acc>>bits))
+			if len(data) == cap(data) {
+				break
+			}
+		}
+	}
+
+	// header types 0-7 are shelley addresses with a payment part
+	if len(data) < cap(data) || data[0]>>4 > 7 {
+		return nil, false
+	}
+	return data[1:], true
+}
+
+func stringSet(ss []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(ss))
+	for _, s := range ss {
+		set[s] = struct{}{}
+	}
+	return set
+}
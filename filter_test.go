@@ -0,0 +1,173 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogmigo
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	fixtureMintTx    = "701be1dbbe09698d412f617fcb30dce87071ce17b8202b03b47d8295f4330e73"
+	fixturePaymentTx = "58924fded958dda8a7ac6a120f00eea7e7374ff8ce54751e4ce9db689604b90c"
+)
+
+func TestFilterBlock(t *testing.T) {
+	block, err := os.ReadFile("ouroboros/chainsync/compatibility/test_data/Response_NextBlock_v6.json")
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	tests := map[string]struct {
+		filter TxFilter
+		want   []string
+	}{
+		"address": {
+			filter: FilterAddress("addr_test1qr0y0q76tdu63exxxfhrcq00u3vpz3jfe0dnevcy5e6tlx23r7kvyuvvj8njqwhrrsv4jsw73uv0apx966rksaa66hzqpu75h5"),
+			want:   []string{fixturePaymentTx},
+		},
+		"payment credential": {
+			filter: FilterPaymentCredential("de4783da5b79a8e4c6326e3c01efe458114649cbdb3cb304a674bf99"),
+			want:   []string{fixturePaymentTx},
+		},
+		"payment credential of pointer address": {
+			filter: FilterPaymentCredential("949cd07747c03c212ac066f4938cbab042fba67fc51679e062a5b45b"),
+			want:   []string{fixturePaymentTx},
+		},
+		"minted policy": {
+			filter: FilterPolicyID("4d50a11e297e7783383bf06dd6e4e481230323bd96cd8b8d9ee3888d"),
+			want:   []string{fixtureMintTx},
+		},
+		"paid policy": {
+			filter: FilterPolicyID("2db8410d969b6ad6b6969703c77ebf6c44061aa51c5d6ceba46557e2"),
+			want:   []string{fixturePaymentTx},
+		},
+		"tx id": {
+			filter: FilterTxID(fixtureMintTx, "unknown"),
+			want:   []string{fixtureMintTx},
+		},
+		"metadata label": {
+			filter: FilterMetadataLabel(2),
+			want:   []string{fixturePaymentTx},
+		},
+		"no match": {
+			filter: FilterMetadataLabel(674),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			data, err := filterBlock(block, []TxFilter{tc.filter})
+			if err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+
+			var response chainsync.ResponsePraos
+			if err := json.Unmarshal(data, &response); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			result := response.MustNextBlockResult()
+			if got, want := result.Block.ID, "318526c2ef7051faa19f51e43c0960f0b756ff4fc3a80eedc6aca464cfa543a4"; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+
+			var got []string
+			for _, tx := range result.Block.Transactions {
+				got = append(got, tx.ID)
+			}
+			if len(got) != len(tc.want) || (len(got) > 0 && got[0] != tc.want[0]) {
+				t.Fatalf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPaymentCredential(t *testing.T) {
+	tests := map[string]struct {
+		address string
+		want    string
+	}{
+		"base": {
+			address: "addr1q8qgshfmdt5vkx2msf48qtvg3pgurrgxau482m2yyw0c2483lhxjm7kxtt28lhsfkd9mlwtlj3z92nm7zs3m30w7h4hqarsdu2",
+			want:    "c0885d3b6ae8cb195b826a702d888851c18d06ef2a756d44239f8554",
+		},
+		"byron": {
+			address: "DdzFFzCqrhsfYMUNRxtQ5NNKbWVw3ZJBNcMLLZSoqmD5trHHPBDwsjonoBgw1K6e8Qi8bEMs5Y62yZfReEVSFFMncFYDUHUTMM436KjQ",
+		},
+		"stake": {
+			address: "stake1uyfz49rtntfa9h0s98f6s28sg69weemgjhc4e8hm66d5yacalmqha",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			credential, ok := paymentCredential(tc.address)
+			if ok != (tc.want != "") {
+				t.Fatalf("got %v; want %v", ok, tc.want != "")
+			}
+			if got := hex.EncodeToString(credential); got != tc.want {
+				t.Fatalf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestClient_ChainSyncFilter(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	block, err := os.ReadFile("ouroboros/chainsync/compatibility/test_data/Response_NextBlock_v6.json")
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	client := New(
+		WithTransport(NewMemoryTransport(func(ctx context.Context, conn Conn) {
+			_, _, _ = conn.ReadMessage() // findIntersection
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","method":"findIntersection","result":{"intersection":"origin","tip":{"slot":1,"id":"tip","height":1}}}`))
+			_, _, _ = conn.ReadMessage() // nextBlock
+			_ = conn.WriteMessage(websocket.TextMessage, block)
+			<-ctx.Done()
+		})),
+		WithLogger(NopLogger),
+		WithPipeline(1),
+	)
+	defer client.Close()
+
+	handler := &handlerRecorder{done: make(chan struct{}), want: 1}
+	closer, err := client.ChainSyncWithHandler(ctx, handler, WithFilter(FilterTxID(fixtureMintTx)))
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	defer closer.Close()
+
+	select {
+	case <-ctx.Done():
+		t.Fatalf("got %v; want block", ctx.Err())
+	case <-handler.done:
+	}
+
+	txs := handler.blocks[0].Transactions
+	if len(txs) != 1 || txs[0].ID != fixtureMintTx {
+		t.Fatalf("got %v transactions; want %v", len(txs), fixtureMintTx)
+	}
+}
@@ -0,0 +1,533 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogmigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync"
+)
+
+const (
+	// hubHistory is the number of messages the hub retains so subscribers
+	// can rejoin the shared stream
+	hubHistory = 512
+
+	// defaultSubscriberBuffer is the number of messages buffered for each
+	// subscriber
+	defaultSubscriberBuffer = 64
+)
+
+var (
+	// errCaughtUp stops the connection of a subscriber that has rejoined the
+	// shared stream
+	errCaughtUp = errors.New("subscriber caught up with chainsync hub")
+
+	// errHubStopped indicates the upstream ChainSync of the hub has stopped
+	errHubStopped = errors.New("chainsync hub stopped")
+)
+
+// SlowConsumerPolicy determines what the hub does when a subscriber's buffer
+// is full
+type SlowConsumerPolicy int
+
+const (
+	// SlowConsumerBlock pauses the upstream ChainSync, and with it every
+	// other subscriber, until the subscriber has room
+	SlowConsumerBlock SlowConsumerPolicy = iota
+	// SlowConsumerDrop discards messages the subscriber has no room for.
+	// The subscriber no longer sees every block, so this suits consumers
+	// that only follow the tip.
+	SlowConsumerDrop
+	// SlowConsumerDetach detaches the subscriber from the shared stream.
+	// Once the subscriber has drained its buffer, it replays from its last
+	// point, using the hub's history if it still holds the point and its own
+	// connection otherwise, and then rejoins the shared stream.
+	SlowConsumerDetach
+)
+
+// SubscribeOptions configuration parameters
+type SubscribeOptions struct {
+	buffer int                // messages buffered for the subscriber
+	policy SlowConsumerPolicy // policy once the buffer is full
+	store  Store              // store of the subscriber's points
+}
+
+func buildSubscribeOptions(opts ...SubscribeOption) SubscribeOptions {
+	var options SubscribeOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.buffer <= 0 {
+		options.buffer = defaultSubscriberBuffer
+	}
+	if options.store == nil {
+		options.store = nopStore{}
+	}
+	return options
+}
+
+// SubscribeOption provides functional options for Subscribe
+type SubscribeOption func(opts *SubscribeOptions)
+
+// WithBufferSize sets the number of messages buffered for the subscriber.
+// Defaults to 64.
+func WithBufferSize(n int) SubscribeOption {
+	return func(opts *SubscribeOptions) {
+		opts.buffer = n
+	}
+}
+
+// WithSlowConsumerPolicy sets what the hub does when the subscriber's buffer
+// is full.  Defaults to SlowConsumerBlock.
+func WithSlowConsumerPolicy(policy SlowConsumerPolicy) SubscribeOption {
+	return func(opts *SubscribeOptions) {
+		opts.policy = policy
+	}
+}
+
+// WithSubscriberStore checkpoints the subscriber's progress to store.  The
+// subscriber resumes from the points in store, catching up on its own
+// connection if the hub has already moved past them.
+func WithSubscriberStore(store Store) SubscribeOption {
+	return func(opts *SubscribeOptions) {
+		opts.store = store
+	}
+}
+
+// ChainSyncHub runs a single upstream ChainSync, decodes each message once
+// and fans it out to any number of subscribers
+type ChainSyncHub struct {
+	client   *Client
+	options  []ChainSyncOption
+	upstream *ChainSync
+
+	mutex       sync.Mutex
+	history     *circular[*syncMessage]
+	index       map[pointKey]uint64 // point to the seq of its latest message
+	seq         uint64              // number of messages published
+	position    *chainsync.Point    // point of the hub, once intersected
+	subscribers map[*subscriber]struct{}
+	awaiting    map[*subscriber]chainsync.Point // subscribers ahead of the hub
+}
+
+type subscriber struct {
+	options  SubscribeOptions
+	ch       chan *syncMessage
+	done     <-chan struct{} // closed once the subscription ends
+	detached chan struct{}   // closed by the hub on detaching the subscriber
+	missed   chan struct{}   // closed by the hub on passing an awaited point
+}
+
+// pointKey identifies a point in the hub's index
+type pointKey struct {
+	slot uint64
+	id   string
+}
+
+func keyOf(point chainsync.Point) pointKey {
+	if ps, ok := point.PointStruct(); ok {
+		return pointKey{slot: ps.Slot, id: ps.ID}
+	}
+	return pointKey{}
+}
+
+// ChainSyncHub starts a hub whose upstream ChainSync is configured by opts,
+// as for ChainSync.  Subscribers that fall behind the hub connect with the
+// same options, less the store, points and slot bounds.
+func (c *Client) ChainSyncHub(ctx context.Context, opts ...ChainSyncOption) (*ChainSyncHub, error) {
+	hub := &ChainSyncHub{
+		client:      c,
+		options:     opts,
+		history:     newCircular[*syncMessage](hubHistory),
+		index:       map[pointKey]uint64{},
+		subscribers: map[*subscriber]struct{}{},
+		awaiting:    map[*subscriber]chainsync.Point{},
+	}
+	upstream, err := c.chainSync(ctx, hub.publish, opts...)
+	if err != nil {
+		return nil, err
+	}
+	hub.upstream = upstream
+	return hub, nil
+}
+
+// Close stops the upstream ChainSync, which fails the subscriptions following
+// the shared stream
+func (h *ChainSyncHub) Close() error {
+	return h.upstream.Close()
+}
+
+// Done indicates the upstream ChainSync has terminated
+func (h *ChainSyncHub) Done() <-chan struct{} {
+	return h.upstream.Done()
+}
+
+// Err returns the error that terminated the upstream ChainSync
+func (h *ChainSyncHub) Err() <-chan error {
+	return h.upstream.Err()
+}
+
+// Progress returns the progress of the upstream ChainSync
+func (h *ChainSyncHub) Progress() Progress {
+	return h.upstream.Progress()
+}
+
+// Subscribe passes the hub's messages to handler, from the subscriber's own
+// checkpoint onwards.  Blocks and tips are shared between subscribers and
+// must not be modified.  The returned ChainSync controls the subscription
+// alone.
+func (h *ChainSyncHub) Subscribe(
+	ctx context.Context,
+	handler ChainSyncHandler,
+	opts ...SubscribeOption,
+) (*ChainSync, error) {
+	options := buildSubscribeOptions(opts...)
+
+	done := make(chan struct{})
+	errs := make(chan error, 1)
+	ctx, cancel := context.WithCancel(ctx)
+	progress := newSyncProgress(defaultSyncedSlots)
+
+	sub := &subscriber{
+		options: options,
+		ch:      make(chan *syncMessage, options.buffer),
+		done:    ctx.Done(),
+	}
+
+	go func() {
+		defer close(done)
+		defer h.remove(sub)
+		defer cancel()
+		errs <- h.serve(ctx, sub, handler, progress)
+	}()
+
+	return &ChainSync{
+		cancel:   cancel,
+		errs:     errs,
+		done:     done,
+		logger:   h.client.logger,
+		progress: progress,
+	}, nil
+}
+
+// publish fans the message out to the subscribers
+func (h *ChainSyncHub) publish(ctx context.Context, msg *syncMessage) error {
+	response, err := msg.decode()
+	if err != nil {
+		return err
+	}
+	if response.Error != nil {
+		return FromResultError(response.Method, response.Error)
+	}
+
+	switch response.Method {
+	case chainsync.FindIntersectionMethod:
+		// each subscriber has its own intersection, but those at or ahead
+		// of the hub's may await the hub there
+		position := chainsync.Origin
+		if result := response.MustFindIntersectResult(); result.Intersection != nil {
+			position = *result.Intersection
+		}
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		h.position = &position
+		return nil
+	case chainsync.NextBlockMethod:
+	default:
+		return nil
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.history.add(msg)
+	h.seq++
+	point, ok := msg.point()
+	if ok {
+		h.index[keyOf(point)] = h.seq
+		h.position = &point
+	}
+	if len(h.index) > 2*hubHistory {
+		for key, seq := range h.index {
+			if h.seq-seq >= hubHistory {
+				delete(h.index, key)
+			}
+		}
+	}
+
+	for sub := range h.subscribers {
+		if sub.options.policy == SlowConsumerBlock {
+			select {
+			case sub.ch <- msg:
+			case <-sub.done:
+				delete(h.subscribers, sub)
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			continue
+		}
+
+		select {
+		case sub.ch <- msg:
+		default:
+			if sub.options.policy == SlowConsumerDrop {
+				h.client.logger.Debug("chainsync subscriber too slow: message dropped")
+				continue
+			}
+			h.client.logger.Info("chainsync subscriber too slow: detached")
+			delete(h.subscribers, sub)
+			close(sub.detached)
+		}
+	}
+
+	if ok {
+		h.join(point)
+	}
+	return nil
+}
+
+// join subscribes those awaiting the point the hub has reached, which they
+// have already seen, and notifies those whose point the hub has passed by
+func (h *ChainSyncHub) join(point chainsync.Point) {
+	for sub, p := range h.awaiting {
+		switch {
+		case samePoint(point, p):
+			delete(h.awaiting, sub)
+			h.subscribers[sub] = struct{}{}
+		case slotOf(point) >= slotOf(p):
+			delete(h.awaiting, sub)
+			close(sub.missed)
+		}
+	}
+}
+
+// attach joins the subscriber to the shared stream after point.  Should the
+// hub's history hold point, the messages since are returned for the
+// subscriber to replay first.  Should the hub not yet have reached point,
+// the subscriber awaits it and sub.missed is closed if the hub passes it by.
+// Otherwise, the subscriber must catch up on its own connection.
+func (h *ChainSyncHub) attach(sub *subscriber, point chainsync.Point) ([]*syncMessage, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if seq, ok := h.index[keyOf(point)]; ok && h.seq-seq < hubHistory {
+		history := h.history.list()
+		sub.detached, sub.missed = make(chan struct{}), nil
+		h.subscribers[sub] = struct{}{}
+		return history[len(history)-int(h.seq-seq):], true
+	}
+	if h.position == nil || slotOf(point) >= slotOf(*h.position) {
+		sub.detached, sub.missed = make(chan struct{}), make(chan struct{})
+		h.awaiting[sub] = point
+		return nil, true
+	}
+	return nil, false
+}
+
+func (h *ChainSyncHub) remove(sub *subscriber) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	delete(h.subscribers, sub)
+	delete(h.awaiting, sub)
+}
+
+// serve delivers messages to the subscriber, alternating between the shared
+// stream and its own connection whenever it falls behind the hub
+func (h *ChainSyncHub) serve(
+	ctx context.Context,
+	sub *subscriber,
+	handler ChainSyncHandler,
+	progress *syncProgress,
+) error {
+	points, err := initPoints(ctx, sub.options.store)
+	if err != nil {
+		return err
+	}
+	point := points[0]
+
+	var (
+		last = newCircular[*syncMessage](3)
+		n    uint64
+	)
+	ts, transactional := sub.options.store.(TransactionalStore)
+	defer func() {
+		if transactional {
+			return // each point is committed as it is delivered
+		}
+		if p, ok := firstPoint(last.list()...); ok {
+			_ = h.client.save(context.Background(), sub.options.store, p)
+		}
+	}()
+
+	deliver := func(ctx context.Context, msg *syncMessage) error {
+		var handlerErr error
+		handle := func(ctx context.Context) error {
+			handlerErr = msg.handle(ctx, handler)
+			return handlerErr
+		}
+		var err error
+		if p, ok := msg.point(); ok && transactional {
+			err = h.client.transact(ctx, ts, p, handle)
+		} else {
+			err = handle(ctx)
+		}
+		if handlerErr != nil {
+			return fmt.Errorf("chainsync subscriber stopped: handler failed: %w", handlerErr)
+		}
+		if err != nil {
+			return fmt.Errorf("chainsync subscriber failed: %w", err)
+		}
+		progress.update(msg.data)
+		if p, ok := msg.point(); ok {
+			point = p
+		}
+		if err := pruneRollback(ctx, sub.options.store, msg); err != nil {
+			return fmt.Errorf("chainsync subscriber failed: %w", err)
+		}
+
+		if n++; !transactional && n%h.client.options.saveInterval == 0 {
+			if p, ok := firstPoint(last.prefix(msg)...); ok {
+				if err := h.client.save(ctx, sub.options.store, p); err != nil {
+					return fmt.Errorf("chainsync subscriber failed: %w", err)
+				}
+			}
+		}
+		last.add(msg)
+		return nil
+	}
+
+	// the tip is read first as, once attached, the hub may hold its lock
+	// while waiting on the subscriber
+	tip, _ := h.upstreamTip()
+	replay, ok := h.attach(sub, point)
+	if ok {
+		if err := handler.OnIntersection(ctx, point, tip); err != nil {
+			return fmt.Errorf("chainsync subscriber stopped: handler failed: %w", err)
+		}
+	}
+
+	for {
+		if !ok {
+			if replay, ok, err = h.catchUp(ctx, sub, point, deliver); err != nil || !ok {
+				return err
+			}
+		}
+		for _, msg := range replay {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err := deliver(ctx, msg); err != nil {
+				return err
+			}
+		}
+
+	follow:
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case msg := <-sub.ch:
+				if err := deliver(ctx, msg); err != nil {
+					return err
+				}
+			case <-sub.missed:
+				break follow
+			case <-sub.detached:
+				for {
+					select {
+					case msg := <-sub.ch:
+						if err := deliver(ctx, msg); err != nil {
+							return err
+						}
+					default:
+						break follow
+					}
+				}
+			case <-h.Done():
+				return errHubStopped
+			}
+		}
+
+		replay, ok = h.attach(sub, point)
+	}
+}
+
+// catchUp delivers messages from the subscriber's own connection until the
+// subscriber rejoins the shared stream, returning the messages to replay
+// from the hub's history; attached is false once ctx is done
+func (h *ChainSyncHub) catchUp(
+	ctx context.Context,
+	sub *subscriber,
+	point chainsync.Point,
+	deliver func(ctx context.Context, msg *syncMessage) error,
+) (replay []*syncMessage, attached bool, err error) {
+	fn := func(ctx context.Context, msg *syncMessage) error {
+		if err := deliver(ctx, msg); err != nil {
+			return err
+		}
+		if p, ok := msg.point(); ok {
+			if replay, attached = h.attach(sub, p); attached {
+				return errCaughtUp
+			}
+		}
+		return nil
+	}
+
+	opts := append(h.options[:len(h.options):len(h.options)], func(opts *ChainSyncOptions) {
+		opts.maxSlot, opts.minSlot, opts.stopPoint = 0, 0, nil
+		opts.points = chainsync.Points{point}
+		opts.store = nopStore{}
+		opts.synced = nil
+	})
+	cs, err := h.client.chainSync(ctx, fn, opts...)
+	if err != nil {
+		return nil, false, err
+	}
+	<-cs.Done()
+	if err := <-cs.Err(); err != nil && !errors.Is(err, errCaughtUp) {
+		return nil, false, err
+	}
+	return replay, attached, nil
+}
+
+// upstreamTip returns the tip carried by the most recent shared message
+func (h *ChainSyncHub) upstreamTip() (chainsync.PointStruct, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	history := h.history.list()
+	if len(history) == 0 {
+		return chainsync.PointStruct{}, false
+	}
+	nbr, ok := history[len(history)-1].nextBlock()
+	if !ok || nbr.Tip == nil {
+		return chainsync.PointStruct{}, false
+	}
+	return *nbr.Tip, true
+}
+
+// samePoint reports whether the points refer to the same block
+func samePoint(a, b chainsync.Point) bool {
+	as, aok := a.PointStruct()
+	bs, bok := b.PointStruct()
+	if !aok || !bok {
+		return aok == bok // both origin
+	}
+	return as.Slot == bs.Slot && as.ID == bs.ID
+}
@@ -0,0 +1,319 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogmigo
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ogmiostest"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync"
+)
+
+// hubRecorder records the heights of the blocks delivered to a subscriber
+type hubRecorder struct {
+	gate chan struct{} // if set, each block waits for gate to close
+	want int
+	done chan struct{}
+
+	mutex   sync.Mutex
+	heights []uint64
+}
+
+func newHubRecorder(want int) *hubRecorder {
+	return &hubRecorder{want: want, done: make(chan struct{})}
+}
+
+func (h *hubRecorder) OnIntersection(context.Context, chainsync.Point, chainsync.PointStruct) error {
+	return nil
+}
+
+func (h *hubRecorder) OnRollForward(_ context.Context, block *chainsync.Block, _ chainsync.PointStruct) error {
+	if h.gate != nil {
+		<-h.gate
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.heights = append(h.heights, block.Height)
+	if len(h.heights) == h.want {
+		close(h.done)
+	}
+	return nil
+}
+
+func (h *hubRecorder) OnRollBackward(context.Context, chainsync.Point, chainsync.PointStruct) error {
+	return nil
+}
+
+// assertHeights verifies the recorder received each height from first to
+// first+want-1 exactly once, in order
+func (h *hubRecorder) assertHeights(t *testing.T, first uint64) {
+	t.Helper()
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if len(h.heights) != h.want {
+		t.Fatalf("got %v blocks; want %v", len(h.heights), h.want)
+	}
+	for i, height := range h.heights {
+		if want := first + uint64(i); height != want {
+			t.Fatalf("got %v; want %v", h.heights, want)
+		}
+	}
+}
+
+func TestChainSyncHub(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	const n = 40
+	server := ogmiostest.NewServer()
+	defer server.Close()
+	for height := uint64(1); height <= n; height++ {
+		server.RollForward(testBlock(height, strconv.FormatUint(height, 10)))
+	}
+
+	client := New(WithEndpoint(server.URL), WithLogger(NopLogger), WithInterval(1))
+	defer client.Close()
+
+	hub, err := client.ChainSyncHub(ctx)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	defer hub.Close()
+
+	var (
+		fast    = newHubRecorder(n)
+		slow    = newHubRecorder(n)
+		resumed = newHubRecorder(n - 5)
+		store   = &recordingStore{}
+	)
+	slow.gate = make(chan struct{})
+
+	subscriptions := []struct {
+		handler *hubRecorder
+		opts    []SubscribeOption
+	}{
+		{handler: fast},
+		{handler: slow, opts: []SubscribeOption{WithBufferSize(2), WithSlowConsumerPolicy(SlowConsumerDetach), WithSubscriberStore(store)}},
+		{handler: resumed, opts: []SubscribeOption{WithSubscriberStore(mockStore{pp: chainsync.Points{testBlock(5, "5").PointStruct().Point()}})}},
+	}
+	var closers []*ChainSync
+	for _, s := range subscriptions {
+		closer, err := hub.Subscribe(ctx, s.handler, s.opts...)
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		closers = append(closers, closer)
+	}
+
+	// the slow subscriber neither holds back the others nor misses blocks
+	for _, recorder := range []*hubRecorder{fast, resumed} {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("got %v; want all blocks", ctx.Err())
+		case <-recorder.done:
+		}
+	}
+	close(slow.gate)
+	select {
+	case <-ctx.Done():
+		t.Fatalf("got %v; want all blocks", ctx.Err())
+	case <-slow.done:
+	}
+	for _, closer := range closers {
+		_ = closer.Close()
+		<-closer.Done()
+	}
+
+	fast.assertHeights(t, 1)
+	slow.assertHeights(t, 1)
+	resumed.assertHeights(t, 6)
+
+	// each subscriber rejoins from the hub's history, sharing its connection
+	if got, want := server.Connections(), 1; got != want {
+		t.Fatalf("got %v connections; want %v", got, want)
+	}
+
+	// the slow subscriber checkpoints its own progress
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if len(store.saved) == 0 {
+		t.Fatalf("got no saved points; want at least 1")
+	}
+	if got, want := store.saved[len(store.saved)-1], "slot=380 id=38 block=38"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
+
+func newTestHub() *ChainSyncHub {
+	return &ChainSyncHub{
+		client:      New(WithLogger(NopLogger)),
+		history:     newCircular[*syncMessage](hubHistory),
+		index:       map[pointKey]uint64{},
+		subscribers: map[*subscriber]struct{}{},
+		awaiting:    map[*subscriber]chainsync.Point{},
+	}
+}
+
+// forward returns the nextBlock message rolling forward to the block at height
+func forward(height uint64) *syncMessage {
+	data, _ := json.Marshal(Map{
+		"jsonrpc": "2.0",
+		"method":  chainsync.NextBlockMethod,
+		"result": Map{
+			"direction": chainsync.RollForwardString,
+			"block":     testBlock(height, strconv.FormatUint(height, 10)),
+			"tip":       Map{"slot": 100, "id": "tip", "height": 10},
+		},
+	})
+	return &syncMessage{data: data}
+}
+
+func TestChainSyncHub_publish(t *testing.T) {
+	hub := newTestHub()
+	subscribe := func(policy SlowConsumerPolicy) *subscriber {
+		sub := &subscriber{
+			options:  buildSubscribeOptions(WithBufferSize(1), WithSlowConsumerPolicy(policy)),
+			ch:       make(chan *syncMessage, 1),
+			detached: make(chan struct{}),
+		}
+		hub.subscribers[sub] = struct{}{}
+		return sub
+	}
+
+	var (
+		drop   = subscribe(SlowConsumerDrop)
+		detach = subscribe(SlowConsumerDetach)
+	)
+	for height := uint64(1); height <= 3; height++ {
+		if err := hub.publish(context.Background(), forward(height)); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+	}
+
+	if _, ok := hub.subscribers[drop]; !ok {
+		t.Fatalf("got dropping subscriber detached; want subscribed")
+	}
+	if _, ok := hub.subscribers[detach]; ok {
+		t.Fatalf("got detaching subscriber subscribed; want detached")
+	}
+	select {
+	case <-detach.detached:
+	default:
+		t.Fatalf("got detached open; want closed")
+	}
+
+	// the detached subscriber rejoins by replaying the history after its
+	// point, however much exceeds its buffer
+	msg := <-detach.ch
+	point, _ := msg.point()
+	replay, ok := hub.attach(detach, point)
+	if !ok {
+		t.Fatalf("got not attached; want attached")
+	}
+	var heights []uint64
+	for _, msg := range replay {
+		nbr, _ := msg.nextBlock()
+		heights = append(heights, nbr.Block.Height)
+	}
+	if want := []uint64{2, 3}; !reflect.DeepEqual(heights, want) {
+		t.Fatalf("got %v; want %v", heights, want)
+	}
+	if _, ok := hub.subscribers[detach]; !ok {
+		t.Fatalf("got detaching subscriber detached; want subscribed")
+	}
+}
+
+func TestChainSyncHub_attach(t *testing.T) {
+	point := func(height uint64) chainsync.Point {
+		return testBlock(height, strconv.FormatUint(height, 10)).PointStruct().Point()
+	}
+	newSubscriber := func() *subscriber {
+		return &subscriber{
+			options: buildSubscribeOptions(),
+			ch:      make(chan *syncMessage, defaultSubscriberBuffer),
+		}
+	}
+
+	message := func(method string, result Map) *syncMessage {
+		data, _ := json.Marshal(Map{"jsonrpc": "2.0", "method": method, "result": result})
+		return &syncMessage{data: data}
+	}
+	tip := Map{"slot": 100, "id": "tip", "height": 10}
+
+	hub := newTestHub()
+	intersection := message(chainsync.FindIntersectionMethod, Map{"intersection": point(2), "tip": tip})
+	if err := hub.publish(context.Background(), intersection); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	// a fresh hub is awaited by subscribers at or ahead of it
+	var (
+		at     = newSubscriber()
+		ahead  = newSubscriber()
+		fork   = newSubscriber()
+		behind = newSubscriber()
+	)
+	for sub, p := range map[*subscriber]chainsync.Point{
+		at:    point(2),
+		ahead: point(5),
+		fork:  chainsync.PointStruct{Slot: 40, ID: "fork"}.Point(),
+	} {
+		if replay, ok := hub.attach(sub, p); !ok || len(replay) > 0 {
+			t.Fatalf("got %v, %v; want awaiting", replay, ok)
+		}
+	}
+	if _, ok := hub.attach(behind, point(1)); ok {
+		t.Fatalf("got attached; want subscriber behind the hub to catch up")
+	}
+
+	// ogmios rolls back to the intersection first
+	messages := []*syncMessage{
+		message(chainsync.NextBlockMethod, Map{"direction": chainsync.RollBackwardString, "point": point(2), "tip": tip}),
+	}
+	for height := uint64(3); height <= 5; height++ {
+		messages = append(messages, forward(height))
+	}
+	for _, msg := range messages {
+		if err := hub.publish(context.Background(), msg); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+	}
+
+	// subscribers see only the messages after their point
+	for sub, want := range map[*subscriber]int{at: 3, ahead: 0} {
+		if _, ok := hub.subscribers[sub]; !ok {
+			t.Fatalf("got not subscribed; want subscribed")
+		}
+		if got := len(sub.ch); got != want {
+			t.Fatalf("got %v messages; want %v", got, want)
+		}
+	}
+	select {
+	case <-fork.missed:
+	default:
+		t.Fatalf("got missed open; want closed once the hub passed the fork")
+	}
+	if len(hub.awaiting) > 0 {
+		t.Fatalf("got %v awaiting; want none", len(hub.awaiting))
+	}
+}
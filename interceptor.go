@@ -0,0 +1,173 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogmigo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/buger/jsonparser"
+	"github.com/gorilla/websocket"
+)
+
+// Request is an outgoing one-shot request e.g. a ledger state query.
+// Interceptors may modify Method and Params before the request is sent.
+type Request struct {
+	ID     uint64      // ID routes the response back to the caller
+	Method string      // Method e.g. queryLedgerState/tip
+	Params interface{} // Params of the request; nil if none
+
+	payload Map
+}
+
+// newRequest assigns the payload a unique request id
+func (c *Client) newRequest(payload Map) *Request {
+	req := &Request{
+		ID:      atomic.AddUint64(&c.requestID, 1),
+		payload: payload,
+	}
+	if isJSONRPC(payload) {
+		req.Method, _ = payload["method"].(string)
+		req.Params = payload["params"]
+	} else {
+		req.Method, _ = payload["methodname"].(string)
+		req.Params = payload["args"]
+	}
+	return req
+}
+
+// encode returns the request as sent over the wire, tagged with the request
+// id.  JSON-RPC requests carry the id in the id field; jsonwsp requests have
+// it reflected via mirror.
+func (r *Request) encode() ([]byte, error) {
+	m := make(Map, len(r.payload)+1)
+	for k, v := range r.payload {
+		m[k] = v
+	}
+	if isJSONRPC(r.payload) {
+		m["method"] = r.Method
+		m["params"] = r.Params
+		m["id"] = r.ID
+	} else {
+		m["methodname"] = r.Method
+		m["args"] = r.Params
+		m["mirror"] = Map{"id": r.ID}
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+	return data, nil
+}
+
+func isJSONRPC(payload Map) bool {
+	_, ok := payload["jsonrpc"]
+	return ok
+}
+
+// Invoker sends the request to ogmios and returns the raw response
+type Invoker func(ctx context.Context, req *Request) ([]byte, error)
+
+// QueryInterceptor intercepts one-shot requests.  An interceptor may record
+// or modify the request, time or skip the call to invoke, and record or
+// replace the raw response.  Returning without calling invoke short-circuits
+// the request.
+type QueryInterceptor func(ctx context.Context, req *Request, invoke Invoker) ([]byte, error)
+
+// Direction of a StreamMessage
+type Direction int
+
+const (
+	// Outbound messages are sent by the client to ogmios
+	Outbound Direction = iota
+	// Inbound messages are received by the client from ogmios
+	Inbound
+)
+
+func (d Direction) String() string {
+	if d == Inbound {
+		return "inbound"
+	}
+	return "outbound"
+}
+
+// StreamMessage is a message exchanged over a ChainSync or MonitorMempool
+// connection e.g. nextBlock requests and their responses
+type StreamMessage struct {
+	Direction Direction
+	Method    string    // Method e.g. nextBlock
+	Data      []byte    // Data holds the raw json message
+	Time      time.Time // Time the message was received or is about to be sent
+}
+
+// StreamHandler writes an outbound message or delivers an inbound one
+type StreamHandler func(ctx context.Context, msg *StreamMessage) error
+
+// StreamInterceptor intercepts streaming messages.  An interceptor may record
+// or modify msg before passing it to next.  Returning without calling next
+// drops the message; returning an error stops the stream.
+type StreamInterceptor func(ctx context.Context, msg *StreamMessage, next StreamHandler) error
+
+// intercept passes req through the query interceptors before invoking it
+func (c *Client) intercept(ctx context.Context, req *Request, invoke Invoker) ([]byte, error) {
+	interceptors := c.options.queryInterceptors
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoke
+		invoke = func(ctx context.Context, req *Request) ([]byte, error) {
+			return interceptor(ctx, req, next)
+		}
+	}
+	return invoke(ctx, req)
+}
+
+// interceptStream passes the message through the stream interceptors before
+// handing it to handler
+func (c *Client) interceptStream(
+	ctx context.Context,
+	direction Direction,
+	data []byte,
+	handler StreamHandler,
+) error {
+	msg := &StreamMessage{
+		Direction: direction,
+		Data:      data,
+	}
+
+	interceptors := c.options.streamInterceptors
+	if len(interceptors) == 0 {
+		return handler(ctx, msg)
+	}
+
+	msg.Method, _ = jsonparser.GetString(data, "method")
+	msg.Time = time.Now()
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, msg *StreamMessage) error {
+			return interceptor(ctx, msg, next)
+		}
+	}
+	return handler(ctx, msg)
+}
+
+// writeStream returns a StreamHandler that writes messages to conn
+func writeStream(conn Conn) StreamHandler {
+	return func(_ context.Context, msg *StreamMessage) error {
+		return conn.WriteMessage(websocket.TextMessage, msg.Data)
+	}
+}
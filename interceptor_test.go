@@ -0,0 +1,148 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogmigo
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync"
+)
+
+func TestClient_QueryInterceptors(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	t.Run("record", func(t *testing.T) {
+		var calls []string
+		record := func(name string) QueryInterceptor {
+			return func(ctx context.Context, req *Request, invoke Invoker) ([]byte, error) {
+				calls = append(calls, name+":"+req.Method)
+				if req.ID == 0 {
+					t.Fatalf("got 0; want request id")
+				}
+				return invoke(ctx, req)
+			}
+		}
+		client := New(
+			WithTransport(NewMemoryTransport(memoryOgmios(10))),
+			WithQueryInterceptors(record("outer"), record("inner")),
+			WithLogger(NopLogger),
+		)
+		defer client.Close()
+
+		if _, err := client.ChainTip(ctx); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := strings.Join(calls, ","), "outer:queryLedgerState/tip,inner:queryLedgerState/tip"; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("short-circuit", func(t *testing.T) {
+		cached := func(ctx context.Context, req *Request, invoke Invoker) ([]byte, error) {
+			return []byte(`{"jsonrpc":"2.0","result":{"slot":42,"id":"cached"}}`), nil
+		}
+		client := New(
+			WithTransport(&flakyTransport{failures: 1000}),
+			WithQueryInterceptors(cached),
+			WithLogger(NopLogger),
+		)
+		defer client.Close()
+
+		tip, err := client.ChainTip(ctx)
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if ps, _ := tip.PointStruct(); ps == nil || ps.Slot != 42 {
+			t.Fatalf("got %#v; want slot 42", tip)
+		}
+	})
+}
+
+func TestClient_StreamInterceptors(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var (
+		mutex    sync.Mutex
+		messages []string
+	)
+	record := func(ctx context.Context, msg *StreamMessage, next StreamHandler) error {
+		if msg.Time.IsZero() {
+			t.Errorf("got zero; want message time")
+		}
+		mutex.Lock()
+		messages = append(messages, msg.Direction.String()+":"+msg.Method)
+		mutex.Unlock()
+		return next(ctx, msg)
+	}
+	// drop the first block so the callback only sees the second
+	var dropped bool
+	drop := func(ctx context.Context, msg *StreamMessage, next StreamHandler) error {
+		if msg.Direction == Inbound && msg.Method == chainsync.NextBlockMethod && !dropped {
+			dropped = true
+			return nil
+		}
+		return next(ctx, msg)
+	}
+
+	client := New(
+		WithTransport(NewMemoryTransport(memoryOgmios(2))),
+		WithStreamInterceptors(record, drop),
+		WithLogger(NopLogger),
+	)
+	defer client.Close()
+
+	received := make(chan uint64, 2)
+	callback := func(ctx context.Context, data []byte) error {
+		if point, ok := getPoint(data); ok {
+			ps, _ := point.PointStruct()
+			received <- ps.Slot
+		}
+		return nil
+	}
+	closer, err := client.ChainSync(ctx, callback)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	defer closer.Close()
+
+	select {
+	case slot := <-received:
+		if slot != 20 {
+			t.Fatalf("got %v; want 20", slot)
+		}
+	case <-ctx.Done():
+		t.Fatalf("got timeout; want block")
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	got := strings.Join(messages, ",")
+	for _, want := range []string{
+		"outbound:findIntersection",
+		"inbound:findIntersection",
+		"outbound:nextBlock",
+		"inbound:nextBlock",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	}
+}
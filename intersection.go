@@ -0,0 +1,282 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogmigo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync"
+	"github.com/buger/jsonparser"
+)
+
+// IntersectionFallback determines what ChainSync does when none of the
+// points from the Store or WithPoints are on chain, e.g. after a rollback
+// deeper than the saved checkpoints or when connected to another network
+type IntersectionFallback int
+
+const (
+	// IntersectionFallbackNone delivers the failed findIntersection response
+	// and carries on from origin, as ogmios does; the default
+	IntersectionFallbackNone IntersectionFallback = iota
+	// IntersectionFallbackFail stops the ChainSync with an *IntersectionError
+	IntersectionFallbackFail
+	// IntersectionFallbackOrigin restarts the ChainSync from origin
+	IntersectionFallbackOrigin
+	// IntersectionFallbackWalkBack retries with the points from the Store not
+	// yet offered, newest first and spaced exponentially further apart, and
+	// finally with origin
+	IntersectionFallbackWalkBack
+)
+
+// walkBackSlots is the distance, in slots, from the newest point of a walk
+// back attempt to the next; the distance doubles with each further point
+const walkBackSlots = 2160
+
+// maxIntersectPoints is the most points offered by a single findIntersection
+const maxIntersectPoints = 5
+
+// WithIntersectionFallback sets the policy applied when findIntersection
+// finds none of the points.  With any policy but IntersectionFallbackNone,
+// nextBlock requests are held back until an intersection is found, and the
+// failed findIntersection responses are not delivered.  Either way, the
+// intersection chosen is delivered to the callback, or OnIntersection, as
+// usual and raises an IntersectionEvent.
+func WithIntersectionFallback(fallback IntersectionFallback) ChainSyncOption {
+	return func(opts *ChainSyncOptions) {
+		opts.fallback = fallback
+	}
+}
+
+// IntersectionError indicates that none of the points offered to
+// findIntersection are on chain; it matches ErrIntersectionNotFound
+type IntersectionError struct {
+	Points chainsync.Points      // Points offered to findIntersection
+	Tip    chainsync.PointStruct // Tip of the chain
+}
+
+func (e *IntersectionError) Error() string {
+	return fmt.Sprintf("%v: none of %v found on chain with tip %v", ErrIntersectionNotFound, e.Points, e.Tip.Point())
+}
+
+// Is allows errors.Is(err, ErrIntersectionNotFound)
+func (e *IntersectionError) Is(target error) bool {
+	return target == ErrIntersectionNotFound
+}
+
+// intersection tracks the findIntersection requests sent on a connection
+type intersection struct {
+	fallback   IntersectionFallback
+	version    Version
+	candidates chainsync.Points // every known point, newest first, for walking back
+	points     chainsync.Points // points offered by the most recent request
+	attempts   int
+	found      bool
+}
+
+// newIntersection returns the intersection for a connection whose first
+// findIntersection request offers the points loaded from store or, failing
+// that, the points provided
+func newIntersection(
+	ctx context.Context,
+	fallback IntersectionFallback,
+	version Version,
+	store Store,
+	pp ...chainsync.Point,
+) (*intersection, error) {
+	points, err := initPoints(ctx, store, pp...)
+	if err != nil {
+		return nil, err
+	}
+
+	i := &intersection{
+		fallback: fallback,
+		version:  version,
+		points:   points,
+		attempts: 1,
+	}
+	if fallback == IntersectionFallbackWalkBack {
+		if i.candidates, err = store.Load(ctx); err != nil {
+			return nil, fmt.Errorf("failed to retrieve points from store: %w", err)
+		}
+		if len(i.candidates) == 0 {
+			i.candidates = append(i.candidates, pp...)
+		}
+		sort.Sort(i.candidates)
+	}
+	return i, nil
+}
+
+// receive handles a response awaited by the intersection.  Should the
+// fallback call for another attempt, the findIntersection request to send
+// is returned and the response is not to be delivered.
+func (i *intersection) receive(data []byte) (retry []byte, err error) {
+	tip, notFound := intersectionNotFound(data)
+	if !notFound || i.fallback == IntersectionFallbackNone {
+		i.found = true
+		return nil, nil
+	}
+
+	var points chainsync.Points
+	switch i.fallback {
+	case IntersectionFallbackOrigin:
+		points = chainsync.Points{chainsync.Origin}
+	case IntersectionFallbackWalkBack:
+		i.candidates = without(i.candidates, i.points)
+		points = walkBack(i.candidates)
+		if len(points) == 0 {
+			points = chainsync.Points{chainsync.Origin}
+		}
+	}
+	if len(points) == 0 || containsOrigin(i.points) {
+		return nil, &IntersectionError{Points: i.points, Tip: tip}
+	}
+
+	i.points = points
+	i.attempts++
+	if retry, err = i.request(); err != nil {
+		return nil, fmt.Errorf("failed to create init message: %w", err)
+	}
+	return retry, nil
+}
+
+// request returns the findIntersection request offering the points
+func (i *intersection) request() ([]byte, error) {
+	if i.version == Version5 {
+		return getInitV5(context.Background(), nopStore{}, i.points...)
+	}
+	return getInit(context.Background(), nopStore{}, i.points...)
+}
+
+// reportIntersection logs and observes the intersection found by the response
+func (c *Client) reportIntersection(ctx context.Context, i *intersection, data []byte) {
+	if method, _ := jsonparser.GetString(data, "method"); method != chainsync.FindIntersectionMethod {
+		return
+	}
+	raw, dataType, _, err := jsonparser.Get(data, "result", "intersection")
+	if err != nil {
+		return
+	}
+	point := chainsync.Origin
+	if dataType == jsonparser.Object {
+		if err := json.Unmarshal(raw, &point); err != nil {
+			return
+		}
+	}
+	c.options.logger.Info("ogmigo chainsync intersection found",
+		KV("point", point.String()),
+		KV("attempts", fmt.Sprint(i.attempts)),
+	)
+	if c.observing() {
+		c.observe(ctx, IntersectionEvent{Point: point, Attempts: i.attempts})
+	}
+}
+
+// intersectionNotFound reports whether data is a findIntersection response
+// that found none of the points, along with the tip of the chain
+func intersectionNotFound(data []byte) (chainsync.PointStruct, bool) {
+	if method, _ := jsonparser.GetString(data, "method"); method != chainsync.FindIntersectionMethod {
+		return chainsync.PointStruct{}, false
+	}
+
+	e, _, _, err := jsonparser.Get(data, "error")
+	if err != nil {
+		if e, _, _, err = jsonparser.Get(data, "result", "error"); err != nil {
+			return chainsync.PointStruct{}, false
+		}
+	}
+	if code, _ := jsonparser.GetInt(e, "code"); code != 1000 {
+		return chainsync.PointStruct{}, false
+	}
+
+	// ogmios nests the tip in data; responses converted from v5 do not
+	var tip chainsync.PointStruct
+	raw, _, _, err := jsonparser.Get(e, "data", "tip")
+	if err != nil {
+		raw, _, _, _ = jsonparser.Get(e, "data")
+	}
+	_ = json.Unmarshal(raw, &tip)
+	return tip, true
+}
+
+// walkBack returns up to maxIntersectPoints of the points, which are sorted
+// newest first: the newest, followed by those at exponentially increasing
+// distances behind it.  The oldest of the points is always included once
+// the distances outgrow them.
+func walkBack(points chainsync.Points) chainsync.Points {
+	var older chainsync.Points
+	for _, p := range points {
+		if _, ok := p.PointStruct(); ok {
+			older = append(older, p)
+		}
+	}
+	if len(older) == 0 {
+		return nil
+	}
+
+	var (
+		picked   = chainsync.Points{older[0]}
+		newest   = slotOf(older[0])
+		distance = uint64(walkBackSlots)
+	)
+	for i := 1; i < len(older) && len(picked) < maxIntersectPoints; distance *= 2 {
+		var target uint64
+		if distance < newest {
+			target = newest - distance
+		}
+		for i < len(older)-1 && slotOf(older[i]) > target {
+			i++
+		}
+		picked = append(picked, older[i])
+		i++
+	}
+	return picked
+}
+
+// without returns the points, less those in offered
+func without(points, offered chainsync.Points) chainsync.Points {
+	var remaining chainsync.Points
+	for _, p := range points {
+		var found bool
+		for _, o := range offered {
+			if samePoint(p, o) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			remaining = append(remaining, p)
+		}
+	}
+	return remaining
+}
+
+func containsOrigin(points chainsync.Points) bool {
+	for _, p := range points {
+		if _, ok := p.PointStruct(); !ok {
+			return true
+		}
+	}
+	return false
+}
+
+func slotOf(point chainsync.Point) uint64 {
+	if ps, ok := point.PointStruct(); ok {
+		return ps.Slot
+	}
+	return 0
+}
@@ -0,0 +1,381 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogmigo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ogmiostest"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync"
+	"github.com/gorilla/websocket"
+)
+
+// rollbackRecorder is a handlerRecorder that accepts the rollback to the
+// intersection which ogmios sends first
+type rollbackRecorder struct {
+	*handlerRecorder
+}
+
+func (rollbackRecorder) OnRollBackward(context.Context, chainsync.Point, chainsync.PointStruct) error {
+	return nil
+}
+
+func TestWalkBack(t *testing.T) {
+	var points chainsync.Points
+	for slot := uint64(100_000); slot > 0; slot -= 1_000 {
+		points = append(points, chainsync.PointStruct{Slot: slot, ID: "id"}.Point())
+	}
+
+	slots := func(pp chainsync.Points) (ss []uint64) {
+		for _, p := range pp {
+			ss = append(ss, slotOf(p))
+		}
+		return ss
+	}
+
+	tests := map[string]struct {
+		points chainsync.Points
+		want   []uint64
+	}{
+		"spaced exponentially": {
+			points: points[4:],
+			want:   []uint64{96_000, 93_000, 91_000, 87_000, 78_000},
+		},
+		"oldest reached": {
+			points: points[len(points)-3:],
+			want:   []uint64{3_000, 1_000},
+		},
+		"none": {
+			points: chainsync.Points{chainsync.Origin},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := slots(walkBack(tc.points)); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestIntersectionNotFound(t *testing.T) {
+	tests := map[string]struct {
+		data     string
+		wantTip  uint64
+		notFound bool
+	}{
+		"found": {
+			data: `{"jsonrpc":"2.0","method":"findIntersection","result":{"intersection":"origin","tip":{"slot":10,"id":"a","height":1}}}`,
+		},
+		"not found": {
+			data:     `{"jsonrpc":"2.0","method":"findIntersection","error":{"code":1000,"message":"No intersection found.","data":{"tip":{"slot":10,"id":"a","height":1}}}}`,
+			wantTip:  10,
+			notFound: true,
+		},
+		"converted from v5": {
+			data:     `{"jsonrpc":"2.0","method":"findIntersection","error":{"code":1000,"message":"Intersection not found","data":{"slot":20,"id":"b","height":2}}}`,
+			wantTip:  20,
+			notFound: true,
+		},
+		"next block": {
+			data: `{"jsonrpc":"2.0","method":"nextBlock","error":{"code":1000}}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tip, notFound := intersectionNotFound([]byte(tc.data))
+			if notFound != tc.notFound {
+				t.Fatalf("got %v; want %v", notFound, tc.notFound)
+			}
+			if tip.Slot != tc.wantTip {
+				t.Fatalf("got %v; want %v", tip.Slot, tc.wantTip)
+			}
+		})
+	}
+}
+
+func TestClient_ChainSyncIntersectionFallback(t *testing.T) {
+	server := ogmiostest.NewServer()
+	defer server.Close()
+	for height := uint64(1); height <= 10; height++ {
+		server.RollForward(testBlock(height, strconv.FormatUint(height, 10)))
+	}
+
+	// all but block 3 belong to another chain, including the oldest, which
+	// is offered alongside the newest
+	store := mockStore{pp: chainsync.Points{
+		testBlock(3, "3").PointStruct().Point(),
+		chainsync.PointStruct{Slot: 5, ID: "fork"}.Point(),
+	}}
+	for height := uint64(4); height <= 9; height++ {
+		store.pp = append(store.pp, testBlock(height, "fork").PointStruct().Point())
+	}
+
+	tests := map[string]struct {
+		fallback     IntersectionFallback
+		want         chainsync.Point
+		wantAttempts int
+		wantErr      bool
+	}{
+		"fail": {
+			fallback: IntersectionFallbackFail,
+			wantErr:  true,
+		},
+		"origin": {
+			fallback:     IntersectionFallbackOrigin,
+			want:         chainsync.Origin,
+			wantAttempts: 2,
+		},
+		"walk back": {
+			fallback:     IntersectionFallbackWalkBack,
+			want:         testBlock(3, "3").PointStruct().Point(),
+			wantAttempts: 2,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			var (
+				mutex  sync.Mutex
+				events []IntersectionEvent
+			)
+			observer := ObserverFunc(func(_ context.Context, event Event) {
+				if e, ok := event.(IntersectionEvent); ok {
+					mutex.Lock()
+					defer mutex.Unlock()
+					events = append(events, e)
+				}
+			})
+			client := New(WithEndpoint(server.URL), WithLogger(NopLogger), WithObservers(observer))
+			defer client.Close()
+
+			handler := rollbackRecorder{&handlerRecorder{done: make(chan struct{}), want: 1}}
+			closer, err := client.ChainSyncWithHandler(ctx, handler,
+				WithStore(store),
+				WithIntersectionFallback(tc.fallback),
+			)
+			if err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			defer closer.Close()
+
+			if tc.wantErr {
+				select {
+				case <-ctx.Done():
+					t.Fatalf("got %v; want error", ctx.Err())
+				case <-closer.Done():
+				}
+				err := closer.Close()
+				var ie *IntersectionError
+				if !errors.As(err, &ie) || !errors.Is(err, ErrIntersectionNotFound) {
+					t.Fatalf("got %v; want *IntersectionError", err)
+				}
+				if got, want := ie.Tip.Slot, uint64(100); got != want {
+					t.Fatalf("got %v; want %v", got, want)
+				}
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				t.Fatalf("got %v; want block", ctx.Err())
+			case <-handler.done:
+			}
+			_ = closer.Close()
+			<-closer.Done()
+
+			if len(handler.intersections) != 1 || !samePoint(handler.intersections[0], tc.want) {
+				t.Fatalf("got %v; want %v", handler.intersections, tc.want)
+			}
+			if got, want := handler.blocks[0].Height, slotOf(tc.want)/10+1; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if len(events) != 1 || events[0].Attempts != tc.wantAttempts {
+				t.Fatalf("got %v; want 1 event after %v attempts", events, tc.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestClient_ChainSyncIteratorIntersectionFallback(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	server := ogmiostest.NewServer()
+	defer server.Close()
+	for height := uint64(1); height <= 5; height++ {
+		server.RollForward(testBlock(height, strconv.FormatUint(height, 10)))
+	}
+
+	client := New(WithEndpoint(server.URL), WithLogger(NopLogger))
+	defer client.Close()
+
+	it, err := client.ChainSyncIterator(ctx,
+		WithPoints(testBlock(2, "fork").PointStruct().Point()),
+		WithIntersectionFallback(IntersectionFallbackOrigin),
+	)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	defer it.Close()
+
+	event, err := it.Next(ctx)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if event.Intersection == nil || !samePoint(*event.Intersection, chainsync.Origin) {
+		t.Fatalf("got %#v; want intersection at origin", event)
+	}
+}
+
+// memoryFallbackOgmios serves a chain of n blocks that intersects with origin
+// alone, counting the nextBlock requests received
+func memoryFallbackOgmios(n int, requests *int64) MemoryHandler {
+	return func(ctx context.Context, conn Conn) {
+		var height int
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			var request struct {
+				Method string
+				Params struct{ Points []json.RawMessage }
+				ID     json.RawMessage
+			}
+			if err := json.Unmarshal(data, &request); err != nil {
+				return
+			}
+
+			response := Map{
+				"jsonrpc": "2.0",
+				"method":  request.Method,
+				"id":      request.ID,
+			}
+			tip := Map{"slot": n * 10, "id": "tip", "height": n}
+			switch request.Method {
+			case chainsync.FindIntersectionMethod:
+				response["error"] = Map{"code": 1000, "message": "No intersection found.", "data": Map{"tip": tip}}
+				for _, point := range request.Params.Points {
+					if string(point) == `"origin"` {
+						delete(response, "error")
+						response["result"] = Map{"intersection": "origin", "tip": tip}
+					}
+				}
+			case chainsync.NextBlockMethod:
+				atomic.AddInt64(requests, 1)
+				if height == n {
+					continue // at the tip; await the next block
+				}
+				height++
+				response["result"] = Map{
+					"direction": chainsync.RollForwardString,
+					"tip":       tip,
+					"block":     testBlock(uint64(height), strconv.Itoa(height)),
+				}
+			}
+
+			data, _ = json.Marshal(response)
+			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func TestClient_ChainSyncIntersectionFallbackPipeline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	const (
+		blocks   = 10
+		pipeline = 5
+	)
+	var (
+		requests int64
+		attempts int
+		mutex    sync.Mutex
+	)
+	observer := ObserverFunc(func(_ context.Context, event Event) {
+		if e, ok := event.(IntersectionEvent); ok {
+			mutex.Lock()
+			defer mutex.Unlock()
+			attempts = e.Attempts
+		}
+	})
+	client := New(
+		WithTransport(NewMemoryTransport(memoryFallbackOgmios(blocks, &requests))),
+		WithLogger(NopLogger),
+		WithPipeline(pipeline),
+		WithObservers(observer),
+	)
+	defer client.Close()
+
+	// none of the points are on chain, so the walk back ends at origin
+	var store mockStore
+	for slot := uint64(100_000); slot > 0; slot -= 1_000 {
+		store.pp = append(store.pp, chainsync.PointStruct{Slot: slot, ID: "fork"}.Point())
+	}
+
+	handler := rollbackRecorder{&handlerRecorder{done: make(chan struct{}), want: blocks}}
+	closer, err := client.ChainSyncWithHandler(ctx, handler,
+		WithStore(store),
+		WithIntersectionFallback(IntersectionFallbackWalkBack),
+	)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	defer closer.Close()
+
+	select {
+	case <-ctx.Done():
+		t.Fatalf("got %v; want blocks", ctx.Err())
+	case <-handler.done:
+	}
+
+	// once every block is delivered, the pipeline holds exactly its
+	// capacity of requests awaiting the next block
+	want := int64(blocks + pipeline)
+	for atomic.LoadInt64(&requests) < want && ctx.Err() == nil {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := atomic.LoadInt64(&requests); got != want {
+		t.Fatalf("got %v nextBlock requests; want %v", got, want)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if attempts < 3 {
+		t.Fatalf("got %v attempts; want a multi-step fallback", attempts)
+	}
+}
@@ -0,0 +1,366 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogmigo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync"
+	"github.com/gorilla/websocket"
+)
+
+// ChainSyncEvent is a decoded chainsync message; exactly one of
+// Intersection, Block and RollBackward is set
+type ChainSyncEvent struct {
+	Intersection *chainsync.Point      // Intersection found with the chain
+	Block        *chainsync.Block      // Block rolled forward to
+	RollBackward *chainsync.Point      // RollBackward to the point
+	Tip          chainsync.PointStruct // Tip of the chain
+}
+
+// Point returns the point to Commit once the event has been processed
+func (e ChainSyncEvent) Point() chainsync.Point {
+	switch {
+	case e.Block != nil:
+		return e.Block.PointStruct().Point()
+	case e.RollBackward != nil:
+		return *e.RollBackward
+	case e.Intersection != nil:
+		return *e.Intersection
+	default:
+		return chainsync.Origin
+	}
+}
+
+// eventHandler captures the message passed to a ChainSyncHandler as an event
+type eventHandler struct {
+	event *ChainSyncEvent
+}
+
+func (e eventHandler) OnIntersection(_ context.Context, point chainsync.Point, tip chainsync.PointStruct) error {
+	*e.event = ChainSyncEvent{Intersection: &point, Tip: tip}
+	return nil
+}
+
+func (e eventHandler) OnRollForward(_ context.Context, block *chainsync.Block, tip chainsync.PointStruct) error {
+	*e.event = ChainSyncEvent{Block: block, Tip: tip}
+	return nil
+}
+
+func (e eventHandler) OnRollBackward(_ context.Context, point chainsync.Point, tip chainsync.PointStruct) error {
+	*e.event = ChainSyncEvent{RollBackward: &point, Tip: tip}
+	return nil
+}
+
+// ChainSyncIterator is a pull based alternative to ChainSync.  A nextBlock
+// request is sent each time an event is pulled, so no more than the
+// pipeline's worth of blocks is ever read ahead of the consumer.  Unlike
+// ChainSync, points are saved to the Store only when committed, though a
+// RollbackStore is pruned as each rollback is returned.  A
+// ChainSyncIterator is not safe for concurrent use.
+type ChainSyncIterator struct {
+	client  *Client
+	options ChainSyncOptions
+
+	conn      Conn
+	version   Version
+	next      []byte
+	msgs      chan iteratorMessage
+	closed    chan struct{} // closed once conn is abandoned
+	intersect *intersection // findIntersection requests sent on conn
+	lastSlot  uint64        // slot of the most recent block, for observers
+
+	last *chainsync.Point // point of the most recently returned event
+	done bool             // stop point reached
+
+	once     sync.Once
+	shutdown chan struct{}
+}
+
+type iteratorMessage struct {
+	data []byte
+	err  error
+}
+
+// ChainSyncIterator returns an iterator over the chain, configured by the
+// same options as ChainSync.  WithConfirmations is not supported, and
+// WithDecodeWorkers, WithReconnect and WithSyncedFunc are ignored.  Once the
+// stop point of WithMaxSlot or WithStopPoint is reached, Next returns
+// io.EOF.
+func (c *Client) ChainSyncIterator(ctx context.Context, opts ...ChainSyncOption) (*ChainSyncIterator, error) {
+	options := buildChainSyncOptions(opts...)
+	if options.confirmations > 0 {
+		return nil, fmt.Errorf("chainsync iterator does not support confirmations")
+	}
+
+	it := &ChainSyncIterator{
+		client:   c,
+		options:  options,
+		shutdown: make(chan struct{}),
+	}
+	if err := it.connect(ctx); err != nil {
+		return nil, err
+	}
+	return it, nil
+}
+
+// Next returns the next event, waiting until one is available or ctx is
+// done.  Should the connection fail, Next returns the error; calling Next
+// again reconnects and resumes from the most recently returned event.
+func (it *ChainSyncIterator) Next(ctx context.Context) (ChainSyncEvent, error) {
+	for {
+		if it.done {
+			return ChainSyncEvent{}, io.EOF
+		}
+		if it.conn == nil {
+			if err := it.connect(ctx); err != nil {
+				return ChainSyncEvent{}, err
+			}
+		}
+
+		var m iteratorMessage
+		select {
+		case <-ctx.Done():
+			return ChainSyncEvent{}, ctx.Err()
+		case <-it.shutdown:
+			return ChainSyncEvent{}, errConnClosed
+		case m = <-it.msgs:
+		}
+		if m.err != nil {
+			it.disconnect()
+			return ChainSyncEvent{}, fmt.Errorf("failed to read message from ogmios: %w", m.err)
+		}
+
+		event, ok, err := it.receive(ctx, m.data)
+		if err != nil || ok {
+			return event, err
+		}
+	}
+}
+
+// receive converts the message into an event, if it should be returned
+func (it *ChainSyncIterator) receive(ctx context.Context, data []byte) (ChainSyncEvent, bool, error) {
+	// a server that cannot parse FindIntersect replies in its own wire format
+	if !it.intersect.found {
+		if v, ok := rejectedBy(data); ok && v != it.version {
+			it.client.setServerVersion(v)
+			it.disconnect()
+			if it.options.version != VersionUnknown {
+				return ChainSyncEvent{}, false, &versionError{version: v}
+			}
+			return ChainSyncEvent{}, false, nil // reconnect in the server's format
+		}
+	}
+
+	// each response but the intersection makes room for another request
+	if it.intersect.found {
+		if err := it.request(ctx); err != nil {
+			it.disconnect()
+			return ChainSyncEvent{}, false, err
+		}
+	}
+
+	var err error
+	if it.version == Version5 {
+		if data, err = responseFromV5(data); err != nil {
+			return ChainSyncEvent{}, false, fmt.Errorf("chainsync stopped: %w", err)
+		}
+		if data == nil {
+			return ChainSyncEvent{}, false, nil // byron block
+		}
+	}
+
+	var delivered bool
+	err = it.client.interceptStream(ctx, Inbound, data, func(_ context.Context, msg *StreamMessage) error {
+		data, delivered = msg.Data, true
+		return nil
+	})
+	if err != nil {
+		return ChainSyncEvent{}, false, fmt.Errorf("chainsync stopped: interceptor failed: %w", err)
+	}
+	if !delivered {
+		return ChainSyncEvent{}, false, nil
+	}
+	if !it.intersect.found {
+		retry, err := it.intersect.receive(data)
+		if err != nil {
+			it.disconnect()
+			return ChainSyncEvent{}, false, fmt.Errorf("chainsync stopped: %w", err)
+		}
+		if retry != nil {
+			if err := it.client.interceptStream(ctx, Outbound, retry, writeStream(it.conn)); err != nil {
+				it.disconnect()
+				return ChainSyncEvent{}, false, fmt.Errorf("failed to write FindIntersect: %w", err)
+			}
+			return ChainSyncEvent{}, false, nil
+		}
+		if it.options.fallback != IntersectionFallbackNone {
+			if err := it.fill(ctx); err != nil {
+				return ChainSyncEvent{}, false, err
+			}
+		}
+		it.client.reportIntersection(ctx, it.intersect, data)
+	}
+	if it.client.observing() {
+		it.client.observeNextBlock(ctx, data, &it.lastSlot)
+	}
+	if len(it.options.filters) > 0 {
+		if data, err = filterBlock(data, it.options.filters); err != nil {
+			return ChainSyncEvent{}, false, fmt.Errorf("chainsync stopped: failed to filter block: %w", err)
+		}
+	}
+
+	msg := &syncMessage{data: data}
+	if it.options.minSlot > 0 {
+		if point, ok := msg.point(); ok {
+			if ps, ok := point.PointStruct(); ok && ps.Slot < it.options.minSlot {
+				return ChainSyncEvent{}, false, nil
+			}
+		}
+	}
+	past, at, err := it.options.bounds(msg)
+	if err != nil {
+		return ChainSyncEvent{}, false, err
+	}
+	if past || at {
+		it.done = true
+		it.disconnect()
+	}
+	if past {
+		return ChainSyncEvent{}, false, nil
+	}
+
+	var event ChainSyncEvent
+	if err := msg.handle(ctx, eventHandler{event: &event}); err != nil {
+		return ChainSyncEvent{}, false, err
+	}
+	if err := pruneRollback(ctx, it.options.store, msg); err != nil {
+		return ChainSyncEvent{}, false, err
+	}
+	if event.Block != nil || event.RollBackward != nil {
+		point := event.Point()
+		it.last = &point
+	}
+	return event, true, nil
+}
+
+// Commit saves the point to the Store, typically the Point of an event that
+// has been fully processed.  With a TransactionalStore, call its Transact
+// instead to commit the point along with the writes made for the event.
+func (it *ChainSyncIterator) Commit(ctx context.Context, point chainsync.Point) error {
+	if err := it.client.save(ctx, it.options.store, point); err != nil {
+		return fmt.Errorf("failed to commit point: %w", err)
+	}
+	return nil
+}
+
+// Close the ChainSyncIterator connection; Close may be called concurrently
+// with Next, which then fails
+func (it *ChainSyncIterator) Close() error {
+	it.once.Do(func() { close(it.shutdown) })
+	return nil
+}
+
+// connect opens a new connection, resuming from the most recently returned
+// event, and fills the pipeline with nextBlock requests; with a fallback, the
+// pipeline is filled once the intersection is found
+func (it *ChainSyncIterator) connect(ctx context.Context) error {
+	store := it.options.store
+	if it.last != nil {
+		store = resumeStore{Store: store, point: *it.last}
+	}
+	intersect, next, err := it.client.syncRequests(ctx, it.options, store)
+	if err != nil {
+		return err
+	}
+	init, err := intersect.request()
+	if err != nil {
+		return fmt.Errorf("failed to create init message: %w", err)
+	}
+
+	conn, _, err := it.client.dial(ctx)
+	if err != nil {
+		return err
+	}
+	it.conn, it.version, it.next, it.intersect = conn, intersect.version, next, intersect
+	it.msgs = make(chan iteratorMessage, it.client.options.pipeline+1)
+	it.closed = make(chan struct{})
+	go it.readLoop(conn, it.msgs, it.closed)
+	go func(closed <-chan struct{}) {
+		select {
+		case <-closed:
+		case <-it.shutdown:
+		}
+		_ = conn.Close()
+	}(it.closed)
+
+	if err := it.client.interceptStream(ctx, Outbound, init, writeStream(conn)); err != nil {
+		it.disconnect()
+		return fmt.Errorf("failed to write FindIntersect: %w", err)
+	}
+	if it.options.fallback != IntersectionFallbackNone {
+		return nil
+	}
+	return it.fill(ctx)
+}
+
+// fill sends a pipeline's worth of nextBlock requests
+func (it *ChainSyncIterator) fill(ctx context.Context) error {
+	for i := 0; i < it.client.options.pipeline; i++ {
+		if err := it.request(ctx); err != nil {
+			it.disconnect()
+			return err
+		}
+	}
+	return nil
+}
+
+// request sends a single nextBlock request
+func (it *ChainSyncIterator) request(ctx context.Context) error {
+	if err := it.client.interceptStream(ctx, Outbound, it.next, writeStream(it.conn)); err != nil {
+		return fmt.Errorf("failed to request next block: %w", err)
+	}
+	return nil
+}
+
+func (it *ChainSyncIterator) readLoop(conn Conn, msgs chan<- iteratorMessage, closed <-chan struct{}) {
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err == nil && messageType != websocket.TextMessage {
+			continue
+		}
+
+		select {
+		case msgs <- iteratorMessage{data: data, err: err}:
+		case <-closed:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// disconnect abandons the current connection, which is then closed
+func (it *ChainSyncIterator) disconnect() {
+	if it.conn == nil {
+		return
+	}
+	close(it.closed)
+	it.conn = nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogmigo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ogmiostest"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync"
+)
+
+func TestClient_ChainSyncIterator(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var requests int64
+	countRequests := func(ctx context.Context, msg *StreamMessage, next StreamHandler) error {
+		if msg.Direction == Outbound && msg.Method == chainsync.NextBlockMethod {
+			atomic.AddInt64(&requests, 1)
+		}
+		return next(ctx, msg)
+	}
+	client := New(
+		WithTransport(NewMemoryTransport(memoryOgmios(10))),
+		WithLogger(NopLogger),
+		WithPipeline(2),
+		WithStreamInterceptors(countRequests),
+	)
+	defer client.Close()
+
+	store := &recordingStore{}
+	it, err := client.ChainSyncIterator(ctx, WithStore(store))
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	defer it.Close()
+
+	event, err := it.Next(ctx)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if event.Intersection == nil || event.Intersection.String() != "origin" {
+		t.Fatalf("got %#v; want intersection at origin", event)
+	}
+
+	for height := uint64(1); height <= 10; height++ {
+		event, err := it.Next(ctx)
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if event.Block == nil || event.Block.Height != height {
+			t.Fatalf("got %#v; want block %v", event, height)
+		}
+
+		// requests are paced by the consumer, not read ahead
+		if got, want := atomic.LoadInt64(&requests), int64(2+height); got != want {
+			t.Fatalf("got %v requests; want %v", got, want)
+		}
+
+		if height == 5 {
+			if err := it.Commit(ctx, event.Point()); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+		}
+	}
+
+	store.mutex.Lock()
+	saved := store.saved
+	store.mutex.Unlock()
+	if got, want := saved, []string{"slot=50 id=block block=5"}; len(got) != 1 || got[0] != want[0] {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+
+	// at the tip, Next waits for the next block
+	waitCtx, waitCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer waitCancel()
+	if _, err := it.Next(waitCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v; want context.DeadlineExceeded", err)
+	}
+
+	_ = it.Close()
+	if _, err := it.Next(ctx); err == nil {
+		t.Fatalf("got nil; want err")
+	}
+}
+
+func TestChainSyncIterator_resume(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	server := ogmiostest.NewServer()
+	defer server.Close()
+	for height := uint64(1); height <= 5; height++ {
+		server.RollForward(testBlock(height, strconv.FormatUint(height, 10)))
+	}
+
+	client := New(WithEndpoint(server.URL), WithLogger(NopLogger))
+	defer client.Close()
+
+	it, err := client.ChainSyncIterator(ctx, WithMaxSlot(40))
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	defer it.Close()
+
+	var got []string
+	for {
+		event, err := it.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		switch {
+		case event.Intersection != nil:
+			got = append(got, "intersection:"+event.Intersection.String())
+		case event.RollBackward != nil:
+			got = append(got, "backward:"+event.RollBackward.String())
+		case event.Block != nil:
+			got = append(got, "forward:"+event.Block.ID)
+			if event.Block.ID == "2" {
+				it.disconnect() // as if the connection had dropped
+			}
+		}
+	}
+
+	want := []string{
+		"intersection:origin", "backward:origin", "forward:1", "forward:2",
+		"intersection:slot=20 id=2 block=2", "backward:slot=20 id=2 block=2", "forward:3", "forward:4",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	}
+}
@@ -60,6 +60,14 @@ func buildMonitorMempoolOptions(
 
 type MonitorMempoolOption func(opts *MonitorMempoolOptions)
 
+// WithMempoolReconnect attempt to reconnect to ogmios if connection drops; see
+// WithReconnectPolicy
+func WithMempoolReconnect(enabled bool) MonitorMempoolOption {
+	return func(opts *MonitorMempoolOptions) {
+		opts.reconnect = enabled
+	}
+}
+
 func (c *Client) MonitorMempool(
 	ctx context.Context,
 	callback MonitorMempoolFunc,
@@ -74,32 +82,14 @@ func (c *Client) MonitorMempool(
 	go func() {
 		defer close(done)
 
-		var (
-			timeout = 10 * time.Second
-			err     error
+		errs <- c.reconnect(
+			ctx,
+			ProtocolMempool,
+			options.reconnect,
+			func(ctx context.Context, connected func()) error {
+				return c.doMonitorMempool(ctx, callback, options, connected)
+			},
 		)
-		for {
-			err = c.doMonitorMempool(ctx, callback, options)
-			if err != nil && isTemporaryError(err) {
-				if options.reconnect {
-					c.options.logger.Info(
-						"websocket connection error: will retry",
-						KV("delay", timeout.Round(time.Millisecond).String()),
-						KV("err", err.Error()),
-					)
-
-					select {
-					case <-ctx.Done():
-						return
-					case <-time.After(timeout):
-						continue
-					}
-				}
-			}
-
-			break
-		}
-		errs <- err
 	}()
 
 	return &MonitorMempool{
@@ -136,15 +126,18 @@ func (c *Client) doMonitorMempool(
 	ctx context.Context,
 	callback MonitorMempoolFunc,
 	options MonitorMempoolOptions,
-) error {
-	conn, _, err := websocket.DefaultDialer.Dial(c.options.endpoint, nil)
+	connected func(),
+) (err error) {
+	conn, e, err := c.dial(ctx)
 	if err != nil {
-		return fmt.Errorf(
-			"failed to connect to ogmios, %v: %w",
-			c.options.endpoint,
-			err,
-		)
+		return err
 	}
+	connected()
+	defer func() {
+		if err != nil && IsTemporaryError(err) {
+			c.endpoints.failed(e)
+		}
+	}()
 
 	group, ctx := errgroup.WithContext(ctx)
 	group.Go(func() error {
@@ -176,6 +169,7 @@ func (c *Client) doMonitorMempool(
 			`{"jsonrpc":"2.0","method":"acquireMempool","id":{"step":"MEMPOOLINIT"}}`,
 		)
 		var todo MonitorState
+		write := writeStream(conn)
 		for {
 			select {
 			case <-ctx.Done():
@@ -183,7 +177,7 @@ func (c *Client) doMonitorMempool(
 			case todo = <-ch:
 				switch todo {
 				case AcquireMempool:
-					if err := conn.WriteMessage(websocket.TextMessage, acquireMempool); err != nil {
+					if err := c.interceptStream(ctx, Outbound, acquireMempool, write); err != nil {
 						var oe *net.OpError
 						if ok := errors.As(err, &oe); ok {
 							if v := atomic.LoadInt64(&connState); v > 0 {
@@ -196,7 +190,7 @@ func (c *Client) doMonitorMempool(
 						)
 					}
 				case NextTransaction:
-					if err := conn.WriteMessage(websocket.TextMessage, nextTransaction); err != nil {
+					if err := c.interceptStream(ctx, Outbound, nextTransaction, write); err != nil {
 						return fmt.Errorf(
 							"failed to write nextTransaction: %w",
 							err,
@@ -213,6 +207,7 @@ func (c *Client) doMonitorMempool(
 		ch <- AcquireMempool
 		var transactions []*chainsync.Tx
 		var slot uint64
+		var acquired time.Time
 		for n := uint64(1); ; n++ {
 			messageType, data, err := conn.ReadMessage()
 			if err != nil {
@@ -252,6 +247,18 @@ func (c *Client) doMonitorMempool(
 				// ok
 			}
 
+			var delivered bool
+			err = c.interceptStream(ctx, Inbound, data, func(_ context.Context, msg *StreamMessage) error {
+				data, delivered = msg.Data, true
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("mempool monitoring stopped: interceptor failed: %w", err)
+			}
+			if !delivered {
+				continue
+			}
+
 			var acquireMempoolResponse AcquireMempoolResponse
 			acquireMempoolErr := json.Unmarshal(data, &acquireMempoolResponse)
 
@@ -268,9 +275,25 @@ func (c *Client) doMonitorMempool(
 			if acquireMempoolResponse.Method == "acquireMempool" &&
 				acquireMempoolErr == nil {
 				slot = acquireMempoolResponse.Result.Slot
+				acquired = time.Now()
 				ch <- NextTransaction
 			} else if nextTransactionResponse.Method == "nextTransaction" && nextTransactionResponse.Result.Transaction == nil {
+				if c.observing() {
+					c.observe(ctx, MempoolSnapshotEvent{
+						Slot:         slot,
+						Transactions: len(transactions),
+						Duration:     time.Since(acquired),
+					})
+				}
+				started := time.Now()
 				err := callback(ctx, transactions, slot)
+				if c.observing() {
+					c.observe(ctx, CallbackEvent{
+						Protocol: ProtocolMempool,
+						Duration: time.Since(started),
+						Err:      err,
+					})
+				}
 				transactions = nil
 				if err != nil {
 					return fmt.Errorf("mempool monitoring stopped: callback failed: %w", err)
@@ -0,0 +1,234 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogmigo
+
+import (
+	"context"
+	"time"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync"
+	"github.com/buger/jsonparser"
+)
+
+const (
+	// ProtocolChainSync identifies events raised by ChainSync
+	ProtocolChainSync = "chainsync"
+	// ProtocolMempool identifies events raised by MonitorMempool
+	ProtocolMempool = "mempool"
+)
+
+// Observer receives events describing the activity of ChainSync and
+// MonitorMempool e.g. to export metrics.  Observe is called synchronously from
+// the protocol goroutines, so implementations should be fast and must be
+// safe for concurrent use.
+type Observer interface {
+	Observe(ctx context.Context, event Event)
+}
+
+// ObserverFunc adapts a func to an Observer
+type ObserverFunc func(ctx context.Context, event Event)
+
+// Observe implements Observer
+func (fn ObserverFunc) Observe(ctx context.Context, event Event) {
+	fn(ctx, event)
+}
+
+// Event is one of the *Event types defined in this package
+type Event interface {
+	event()
+}
+
+// RollForwardEvent is raised for each block received by ChainSync
+type RollForwardEvent struct {
+	Slot      uint64
+	Height    uint64
+	TipSlot   uint64
+	TipHeight uint64
+}
+
+// RollBackwardEvent is raised for each rollback received by ChainSync
+type RollBackwardEvent struct {
+	Slot      uint64 // Slot rolled back to; 0 for origin
+	Depth     uint64 // Depth in slots from the last block received
+	TipSlot   uint64
+	TipHeight uint64
+}
+
+// CallbackEvent is raised after each invocation of the user callback
+type CallbackEvent struct {
+	Protocol string
+	Duration time.Duration
+	Err      error
+}
+
+// DeliveredEvent is raised once ChainSync has delivered a block or rollback
+// to the callback.  Unlike RollForwardEvent, it follows delivery, which lags
+// behind receipt with WithConfirmations or WithDecodeWorkers.
+type DeliveredEvent struct {
+	Slot      uint64 // Slot of the block, or of the point rolled back to; 0 for origin
+	Height    uint64 // Height of the block; 0 for rollbacks
+	TipSlot   uint64
+	TipHeight uint64
+}
+
+// PipelineEvent reports how many nextBlock requests are in flight each time
+// a response is received
+type PipelineEvent struct {
+	InFlight int
+	Capacity int
+}
+
+// ReconnectEvent is raised before each reconnect attempt
+type ReconnectEvent struct {
+	Protocol string
+	Attempt  int
+	Delay    time.Duration
+	Err      error // Err that caused the reconnect
+}
+
+// CheckpointEvent is raised each time ChainSync saves a point to the Store
+type CheckpointEvent struct {
+	Point chainsync.Point
+	Err   error
+}
+
+// IntersectionEvent is raised once per connection when ChainSync finds the
+// intersection it resumes from
+type IntersectionEvent struct {
+	Point    chainsync.Point
+	Attempts int // Attempts, including the first, made via WithIntersectionFallback
+}
+
+// MempoolSnapshotEvent is raised for each mempool snapshot delivered by
+// MonitorMempool
+type MempoolSnapshotEvent struct {
+	Slot         uint64
+	Transactions int
+	Duration     time.Duration // Duration from acquiring the snapshot to receiving its last transaction
+}
+
+func (RollForwardEvent) event()     {}
+func (RollBackwardEvent) event()    {}
+func (CallbackEvent) event()        {}
+func (DeliveredEvent) event()       {}
+func (PipelineEvent) event()        {}
+func (ReconnectEvent) event()       {}
+func (CheckpointEvent) event()      {}
+func (IntersectionEvent) event()    {}
+func (MempoolSnapshotEvent) event() {}
+
+// observing returns true if any observers are registered
+func (c *Client) observing() bool {
+	return len(c.options.observers) > 0
+}
+
+func (c *Client) observe(ctx context.Context, event Event) {
+	for _, observer := range c.options.observers {
+		observer.Observe(ctx, event)
+	}
+}
+
+// observeNextBlock raises the events for a nextBlock response.  last holds the
+// slot of the most recent block and is updated in place.
+func (c *Client) observeNextBlock(ctx context.Context, data []byte, last *uint64) {
+	result, _, _, err := jsonparser.Get(data, "result")
+	if err != nil {
+		return
+	}
+	tipSlot, _ := jsonparser.GetInt(result, "tip", "slot")
+	tipHeight, _ := jsonparser.GetInt(result, "tip", "height")
+
+	direction, _ := jsonparser.GetString(result, "direction")
+	switch direction {
+	case chainsync.RollForwardString:
+		slot, _ := jsonparser.GetInt(result, "block", "slot")
+		height, _ := jsonparser.GetInt(result, "block", "height")
+		*last = uint64(slot)
+		c.observe(ctx, RollForwardEvent{
+			Slot:      uint64(slot),
+			Height:    uint64(height),
+			TipSlot:   uint64(tipSlot),
+			TipHeight: uint64(tipHeight),
+		})
+
+	case chainsync.RollBackwardString:
+		slot, _ := jsonparser.GetInt(result, "point", "slot") // origin has no slot
+		var depth uint64
+		if *last > uint64(slot) {
+			depth = *last - uint64(slot)
+		}
+		*last = uint64(slot)
+		c.observe(ctx, RollBackwardEvent{
+			Slot:      uint64(slot),
+			Depth:     depth,
+			TipSlot:   uint64(tipSlot),
+			TipHeight: uint64(tipHeight),
+		})
+	}
+}
+
+// observeDelivered raises a DeliveredEvent for a delivered nextBlock response
+func (c *Client) observeDelivered(ctx context.Context, data []byte) {
+	result, _, _, err := jsonparser.Get(data, "result")
+	if err != nil {
+		return
+	}
+	if method, _ := jsonparser.GetString(data, "method"); method != chainsync.NextBlockMethod {
+		return
+	}
+
+	var slot, height int64
+	switch direction, _ := jsonparser.GetString(result, "direction"); direction {
+	case chainsync.RollForwardString:
+		slot, _ = jsonparser.GetInt(result, "block", "slot")
+		height, _ = jsonparser.GetInt(result, "block", "height")
+	case chainsync.RollBackwardString:
+		slot, _ = jsonparser.GetInt(result, "point", "slot") // origin has no slot
+	default:
+		return
+	}
+	tipSlot, _ := jsonparser.GetInt(result, "tip", "slot")
+	tipHeight, _ := jsonparser.GetInt(result, "tip", "height")
+	c.observe(ctx, DeliveredEvent{
+		Slot:      uint64(slot),
+		Height:    uint64(height),
+		TipSlot:   uint64(tipSlot),
+		TipHeight: uint64(tipHeight),
+	})
+}
+
+// save persists the point to the store, raising a CheckpointEvent
+func (c *Client) save(ctx context.Context, store Store, point chainsync.Point) error {
+	err := store.Save(ctx, point)
+	if c.observing() {
+		c.observe(ctx, CheckpointEvent{Point: point, Err: err})
+	}
+	return err
+}
+
+// transact delivers via fn and saves the point in one transaction of store,
+// raising a CheckpointEvent
+func (c *Client) transact(
+	ctx context.Context,
+	store TransactionalStore,
+	point chainsync.Point,
+	fn func(ctx context.Context) error,
+) error {
+	err := store.Transact(ctx, point, fn)
+	if c.observing() {
+		c.observe(ctx, CheckpointEvent{Point: point, Err: err})
+	}
+	return err
+}
@@ -0,0 +1,136 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogmigo
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder collects the events raised by the client
+type recorder struct {
+	mutex  sync.Mutex
+	events []Event
+}
+
+func (r *recorder) Observe(_ context.Context, event Event) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recorder) list() []Event {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]Event(nil), r.events...)
+}
+
+func TestClient_Observers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var (
+		events recorder
+		store  = mockStore{}
+	)
+	client := New(
+		WithTransport(&flakyTransport{failures: 1, next: NewMemoryTransport(memoryOgmios(3))}),
+		WithReconnectPolicy(ReconnectPolicy{InitialDelay: time.Millisecond}),
+		WithInterval(2),
+		WithObservers(&events),
+		WithLogger(NopLogger),
+	)
+	defer client.Close()
+
+	done := make(chan struct{})
+	var received int
+	callback := func(context.Context, []byte) error {
+		if received++; received == 4 { // intersection + 3 blocks
+			close(done)
+		}
+		return nil
+	}
+	closer, err := client.ChainSync(ctx, callback, WithReconnect(true), WithStore(store))
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	defer closer.Close()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatalf("got timeout; want blocks")
+	}
+
+	var forward, callbacks, pipeline, reconnects, checkpoints int
+	for _, event := range events.list() {
+		switch e := event.(type) {
+		case RollForwardEvent:
+			forward++
+			if got, want := e.Slot, e.Height*10; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := e.TipSlot, uint64(30); got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		case CallbackEvent:
+			callbacks++
+		case PipelineEvent:
+			pipeline++
+			if e.InFlight < 0 || e.InFlight > e.Capacity {
+				t.Fatalf("got %v; want in flight within [0, %v]", e.InFlight, e.Capacity)
+			}
+		case ReconnectEvent:
+			reconnects++
+			if got, want := e.Protocol, ProtocolChainSync; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		case CheckpointEvent:
+			checkpoints++
+		}
+	}
+	// the final callback and checkpoint may still be in progress
+	if forward != 3 || pipeline != 3 || reconnects != 1 || checkpoints < 1 || callbacks < 3 {
+		t.Fatalf("got forward=%v pipeline=%v reconnects=%v checkpoints=%v callbacks=%v",
+			forward, pipeline, reconnects, checkpoints, callbacks)
+	}
+}
+
+func TestClient_observeNextBlock(t *testing.T) {
+	var events recorder
+	client := New(WithObservers(&events), WithLogger(NopLogger))
+	defer client.Close()
+
+	last := uint64(120)
+	data := []byte(`{"method":"nextBlock","result":{"direction":"backward","point":{"slot":100,"id":"a"},"tip":{"slot":130,"height":13}}}`)
+	client.observeNextBlock(context.Background(), data, &last)
+
+	got := events.list()
+	want := RollBackwardEvent{Slot: 100, Depth: 20, TipSlot: 130, TipHeight: 13}
+	if len(got) != 1 || got[0] != want {
+		t.Fatalf("got %#v; want %#v", got, want)
+	}
+	if last != 100 {
+		t.Fatalf("got %v; want 100", last)
+	}
+
+	data = []byte(`{"method":"nextBlock","result":{"direction":"backward","point":"origin","tip":{"slot":130,"height":13}}}`)
+	client.observeNextBlock(context.Background(), data, &last)
+	if got := events.list(); got[1].(RollBackwardEvent).Depth != 100 {
+		t.Fatalf("got %#v; want depth 100", got[1])
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ogmiostest provides an in-process fake ogmios server speaking the
+// v6 JSON-RPC protocol, for use in tests.
+//
+//	server := ogmiostest.NewServer()
+//	defer server.Close()
+//
+//	server.RollForward(blocks...)
+//	server.Respond("queryLedgerState/epoch", 42)
+//	server.InjectFault(ogmiostest.Fault{Method: "nextBlock", Drop: true})
+//
+//	client := ogmigo.New(ogmigo.WithEndpoint(server.URL))
+package ogmiostest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync"
+)
+
+// Error codes returned by the server for invalid requests
+const (
+	CodeParseError          = -32700
+	CodeMethodNotFound      = -32601
+	CodeIntersectionMissing = 1000
+	CodeMempoolNotAcquired  = 4000
+)
+
+// event is a single step of the scripted chain; either block or point is set
+type event struct {
+	block *chainsync.Block
+	point *chainsync.Point // rollback target
+}
+
+// Fault describes a failure to inject into the responses of the server
+type Fault struct {
+	Method    string        // Method to affect e.g. nextBlock; empty for any method
+	Times     int           // Times the fault applies; 0 for every matching request
+	Delay     time.Duration // Delay the response
+	Drop      bool          // Drop closes the connection instead of responding
+	Malformed bool          // Malformed responds with invalid json
+	Error     *Error        // Error responds with the JSON-RPC error
+}
+
+// Error is a JSON-RPC error response
+type Error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// Server is a fake ogmios server.  The chain, query fixtures, mempool and
+// faults may all be changed while clients are connected.
+type Server struct {
+	// URL of the websocket endpoint e.g. ws://127.0.0.1:1234
+	URL string
+
+	server      *httptest.Server
+	connections int64
+
+	mutex     sync.Mutex
+	events    []event
+	changed   chan struct{} // closed and replaced whenever events change
+	responses map[string]json.RawMessage
+	errors    map[string]*Error
+	mempool   [][]json.RawMessage
+	faults    []*Fault
+	closed    chan struct{}
+	once      sync.Once
+}
+
+// NewServer starts a fake ogmios server; callers should Close it when done
+func NewServer() *Server {
+	s := &Server{
+		changed:   make(chan struct{}),
+		responses: map[string]json.RawMessage{},
+		errors:    map[string]*Error{},
+		closed:    make(chan struct{}),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = "ws" + strings.TrimPrefix(s.server.URL, "http")
+	return s
+}
+
+// Close shuts down the server and any open connections
+func (s *Server) Close() {
+	s.once.Do(func() { close(s.closed) })
+	s.server.CloseClientConnections()
+	s.server.Close()
+}
+
+// Connections returns the number of connections accepted so far
+func (s *Server) Connections() int {
+	return int(atomic.LoadInt64(&s.connections))
+}
+
+// RollForward appends blocks to the scripted chain
+func (s *Server) RollForward(blocks ...chainsync.Block) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i := range blocks {
+		block := blocks[i]
+		s.events = append(s.events, event{block: &block})
+	}
+	s.notify()
+}
+
+// RollBackward appends a rollback to point to the scripted chain
+func (s *Server) RollBackward(point chainsync.Point) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.events = append(s.events, event{point: &point})
+	s.notify()
+}
+
+// Respond sets the result returned for method e.g. queryLedgerState/epoch or
+// submitTransaction
+func (s *Server) Respond(method string, result interface{}) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		panic(err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.responses[method] = data
+	delete(s.errors, method)
+}
+
+// RespondError sets the error returned for method
+func (s *Server) RespondError(method string, code int, message string, data interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.errors[method] = &Error{Code: code, Message: message, Data: data}
+	delete(s.responses, method)
+}
+
+// PushMempool queues a mempool snapshot containing the transactions.  Each
+// acquireMempool waits for, and consumes, the next snapshot.
+func (s *Server) PushMempool(transactions ...interface{}) {
+	var snapshot []json.RawMessage
+	for _, tx := range transactions {
+		data, err := json.Marshal(tx)
+		if err != nil {
+			panic(err)
+		}
+		snapshot = append(snapshot, data)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.mempool = append(s.mempool, snapshot)
+	s.notify()
+}
+
+// InjectFault adds a fault; faults apply in the order they were injected
+func (s *Server) InjectFault(fault Fault) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.faults = append(s.faults, &fault)
+}
+
+// notify wakes any requests waiting on the chain or mempool.  Must be called
+// with the mutex held.
+func (s *Server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// fault returns the first fault matching the method, consuming one use
+func (s *Server) fault(method string) *Fault {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, f := range s.faults {
+		if f.Method != "" && f.Method != method {
+			continue
+		}
+		fault := *f
+		if f.Times > 0 {
+			if f.Times--; f.Times == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+		return &fault
+	}
+	return nil
+}
+
+// tip returns the tip of the chain after the first n events
+func tip(events []event, n int) chainsync.Point {
+	for i := n - 1; i >= 0; i-- {
+		e := events[i]
+		if e.block != nil {
+			return e.block.PointStruct().Point()
+		}
+		if e.point != nil {
+			return *e.point
+		}
+	}
+	return chainsync.Origin
+}
+
+func samePoint(a, b chainsync.Point) bool {
+	if a.PointType() != b.PointType() {
+		return false
+	}
+	if as, ok := a.PointStruct(); ok {
+		bs, _ := b.PointStruct()
+		return as.Slot == bs.Slot && as.ID == bs.ID
+	}
+	return true
+}
@@ -0,0 +1,222 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogmiostest_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ogmiostest"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync"
+)
+
+func block(height uint64, id string) chainsync.Block {
+	return chainsync.Block{
+		Type:   "praos",
+		Era:    "babbage",
+		ID:     id,
+		Height: height,
+		Slot:   height * 10,
+	}
+}
+
+func TestServer_ChainSync(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	server := ogmiostest.NewServer()
+	defer server.Close()
+
+	b1 := block(1, "a")
+	server.RollForward(b1, block(2, "b"), block(3, "c"))
+	server.RollBackward(b1.PointStruct().Point())
+	server.RollForward(block(2, "b'"))
+
+	client := ogmigo.New(ogmigo.WithEndpoint(server.URL), ogmigo.WithLogger(ogmigo.NopLogger))
+	defer client.Close()
+
+	var got []string
+	done := make(chan struct{})
+	callback := func(ctx context.Context, data []byte) error {
+		var response chainsync.ResponsePraos
+		if err := json.Unmarshal(data, &response); err != nil {
+			return err
+		}
+		if response.Method != chainsync.NextBlockMethod {
+			return nil
+		}
+		result := response.MustNextBlockResult()
+		switch result.Direction {
+		case chainsync.RollForwardString:
+			got = append(got, "forward:"+result.Block.ID)
+		case chainsync.RollBackwardString:
+			got = append(got, "backward:"+result.Point.String())
+		}
+		if len(got) == 6 {
+			close(done)
+		}
+		return nil
+	}
+	closer, err := client.ChainSync(ctx, callback)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	defer closer.Close()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatalf("got timeout; want chainsync messages, %v", got)
+	}
+
+	want := fmt.Sprintf("backward:%v forward:a forward:b forward:c backward:%v forward:b'",
+		chainsync.Origin, b1.PointStruct().Point())
+	if got := strings.Join(got, " "); got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
+
+func TestServer_Query(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	server := ogmiostest.NewServer()
+	defer server.Close()
+	server.RollForward(block(1, "a"))
+	server.Respond("queryLedgerState/epoch", 42)
+	server.RespondError("queryLedgerState/eraStart", 2002, "unavailable in current era", nil)
+
+	client := ogmigo.New(ogmigo.WithEndpoint(server.URL), ogmigo.WithLogger(ogmigo.NopLogger))
+	defer client.Close()
+
+	epoch, err := client.CurrentEpoch(ctx)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if epoch != 42 {
+		t.Fatalf("got %v; want 42", epoch)
+	}
+
+	tip, err := client.ChainTip(ctx)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if ps, ok := tip.PointStruct(); !ok || ps.Slot != 10 {
+		t.Fatalf("got %v; want slot 10", tip)
+	}
+
+	if _, err := client.EraStart(ctx); !errors.Is(err, ogmigo.ErrUnavailableInEra) {
+		t.Fatalf("got %v; want %v", err, ogmigo.ErrUnavailableInEra)
+	}
+}
+
+func TestServer_Mempool(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	server := ogmiostest.NewServer()
+	defer server.Close()
+	server.PushMempool(chainsync.Tx{ID: "tx1"}, chainsync.Tx{ID: "tx2"})
+
+	client := ogmigo.New(ogmigo.WithEndpoint(server.URL), ogmigo.WithLogger(ogmigo.NopLogger))
+	defer client.Close()
+
+	snapshots := make(chan []*chainsync.Tx, 1)
+	callback := func(ctx context.Context, txs []*chainsync.Tx, slot uint64) error {
+		select {
+		case snapshots <- txs:
+		default:
+		}
+		return nil
+	}
+	closer, err := client.MonitorMempool(ctx, callback)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	defer closer.Close()
+
+	select {
+	case txs := <-snapshots:
+		if len(txs) != 2 || txs[0].ID != "tx1" || txs[1].ID != "tx2" {
+			t.Fatalf("got %v; want tx1, tx2", txs)
+		}
+	case <-ctx.Done():
+		t.Fatalf("got timeout; want mempool snapshot")
+	}
+}
+
+func TestServer_InjectFault(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	server := ogmiostest.NewServer()
+	defer server.Close()
+	server.Respond("queryLedgerState/epoch", 42)
+
+	client := ogmigo.New(ogmigo.WithEndpoint(server.URL), ogmigo.WithLogger(ogmigo.NopLogger))
+	defer client.Close()
+
+	t.Run("error", func(t *testing.T) {
+		server.InjectFault(ogmiostest.Fault{
+			Method: "queryLedgerState/epoch",
+			Times:  1,
+			Error:  &ogmiostest.Error{Code: 2000, Message: "acquire failed"},
+		})
+		if _, err := client.CurrentEpoch(ctx); !errors.Is(err, ogmigo.ErrAcquireFailed) {
+			t.Fatalf("got %v; want %v", err, ogmigo.ErrAcquireFailed)
+		}
+		if _, err := client.CurrentEpoch(ctx); err != nil {
+			t.Fatalf("got %v; want nil once fault is spent", err)
+		}
+	})
+
+	t.Run("slow", func(t *testing.T) {
+		server.InjectFault(ogmiostest.Fault{Times: 1, Delay: time.Second})
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		if _, err := client.CurrentEpoch(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("got %v; want %v", err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		before := server.Connections()
+		server.InjectFault(ogmiostest.Fault{Times: 1, Drop: true})
+		if _, err := client.CurrentEpoch(ctx); err == nil {
+			t.Fatalf("got nil; want error")
+		}
+		if _, err := client.CurrentEpoch(ctx); err != nil {
+			t.Fatalf("got %v; want nil after reconnect", err)
+		}
+		if got := server.Connections(); got <= before {
+			t.Fatalf("got %v; want more than %v connections", got, before)
+		}
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		server.InjectFault(ogmiostest.Fault{Times: 1, Malformed: true})
+		short, cancel := context.WithTimeout(ctx, 250*time.Millisecond)
+		defer cancel()
+		if _, err := client.CurrentEpoch(short); err == nil {
+			t.Fatalf("got nil; want error")
+		}
+	})
+}
@@ -0,0 +1,342 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogmiostest
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync"
+	"github.com/buger/jsonparser"
+	"github.com/gorilla/websocket"
+)
+
+var upgrader = websocket.Upgrader{}
+
+type request struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	ID     json.RawMessage `json:"id"`
+}
+
+// session holds the protocol state of a single connection
+type session struct {
+	server *Server
+	conn   *websocket.Conn
+	done   chan struct{} // closed once the client goes away
+
+	intersected bool
+	cursor      int              // index of the next chain event to serve
+	rollback    *chainsync.Point // pending rollback to the intersection
+
+	acquired bool
+	snapshot []json.RawMessage
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	conn, err := upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		return
+	}
+	//nolint:errcheck
+	defer conn.Close()
+	atomic.AddInt64(&s.connections, 1)
+
+	c := &session{
+		server: s,
+		conn:   conn,
+		done:   make(chan struct{}),
+	}
+	c.serve()
+}
+
+func (c *session) serve() {
+	// buffered so pipelined requests are read while a response waits on the chain
+	requests := make(chan []byte, 1024)
+	go func() {
+		defer close(c.done)
+		for {
+			_, data, err := c.conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			select {
+			case requests <- data:
+			case <-c.server.closed:
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case data := <-requests:
+			if !c.handle(data) {
+				return
+			}
+		case <-c.done:
+			return
+		case <-c.server.closed:
+			return
+		}
+	}
+}
+
+// handle responds to a single request; returns false once the connection
+// should be closed
+func (c *session) handle(data []byte) bool {
+	var req request
+	if err := json.Unmarshal(data, &req); err != nil {
+		return c.write(req, nil, &Error{Code: CodeParseError, Message: err.Error()})
+	}
+
+	if fault := c.server.fault(req.Method); fault != nil {
+		if fault.Delay > 0 && !c.sleep(fault.Delay) {
+			return false
+		}
+		switch {
+		case fault.Drop:
+			return false
+		case fault.Malformed:
+			return c.conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","result":`)) == nil
+		case fault.Error != nil:
+			return c.write(req, nil, fault.Error)
+		}
+	}
+
+	result, e, ok := c.dispatch(req)
+	if !ok {
+		return false
+	}
+	return c.write(req, result, e)
+}
+
+func (c *session) write(req request, result interface{}, e *Error) bool {
+	response := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  req.Method,
+	}
+	if req.ID != nil {
+		response["id"] = req.ID
+	}
+	if e != nil {
+		response["error"] = e
+	} else {
+		response["result"] = result
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		return false
+	}
+	return c.conn.WriteMessage(websocket.TextMessage, data) == nil
+}
+
+// sleep waits for d; returns false if the connection closed first
+func (c *session) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-c.done:
+		return false
+	case <-c.server.closed:
+		return false
+	}
+}
+
+// wait blocks until the server state changes; returns false if the
+// connection closed first
+func (c *session) wait(changed chan struct{}) bool {
+	select {
+	case <-changed:
+		return true
+	case <-c.done:
+		return false
+	case <-c.server.closed:
+		return false
+	}
+}
+
+// dispatch returns the result or error for the request; ok is false if the
+// connection closed while the request was waiting
+func (c *session) dispatch(req request) (result interface{}, e *Error, ok bool) {
+	s := c.server
+
+	switch req.Method {
+	case chainsync.FindIntersectionMethod:
+		result, e := c.findIntersection(req.Params)
+		return result, e, true
+	case chainsync.NextBlockMethod:
+		return c.nextBlock()
+	case "acquireMempool":
+		return c.acquireMempool()
+	case "nextTransaction":
+		result, e := c.nextTransaction(req.Params)
+		return result, e, true
+	case "releaseMempool":
+		c.acquired, c.snapshot = false, nil
+		return map[string]interface{}{"released": "mempool"}, nil, true
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if e, ok := s.errors[req.Method]; ok {
+		return nil, e, true
+	}
+	if result, ok := s.responses[req.Method]; ok {
+		return result, nil, true
+	}
+	switch req.Method {
+	case "queryLedgerState/tip", "queryNetwork/tip":
+		return tip(s.events, len(s.events)), nil, true
+	}
+	return nil, &Error{Code: CodeMethodNotFound, Message: "unknown method " + req.Method}, true
+}
+
+func (c *session) findIntersection(params json.RawMessage) (interface{}, *Error) {
+	var p struct {
+		Points []chainsync.Point `json:"points"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &Error{Code: CodeParseError, Message: err.Error()}
+	}
+
+	s := c.server
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	current := tip(s.events, len(s.events))
+
+	// prefer the most recent block that matches any of the points
+	for i := len(s.events) - 1; i >= -1; i-- {
+		var candidate chainsync.Point
+		switch {
+		case i == -1:
+			candidate = chainsync.Origin
+		case s.events[i].block != nil:
+			candidate = s.events[i].block.PointStruct().Point()
+		default:
+			continue
+		}
+		for _, point := range p.Points {
+			if samePoint(point, candidate) {
+				c.intersected = true
+				c.cursor = i + 1
+				c.rollback = &candidate
+				return map[string]interface{}{"intersection": candidate, "tip": current}, nil
+			}
+		}
+	}
+
+	return nil, &Error{
+		Code:    CodeIntersectionMissing,
+		Message: "No intersection found.",
+		Data:    map[string]interface{}{"tip": current},
+	}
+}
+
+func (c *session) nextBlock() (interface{}, *Error, bool) {
+	if !c.intersected {
+		origin := chainsync.Origin
+		c.intersected = true
+		c.rollback = &origin
+	}
+
+	s := c.server
+	for {
+		s.mutex.Lock()
+		current := tip(s.events, len(s.events))
+		if c.rollback != nil {
+			point := *c.rollback
+			c.rollback = nil
+			s.mutex.Unlock()
+			return map[string]interface{}{
+				"direction": chainsync.RollBackwardString,
+				"point":     point,
+				"tip":       current,
+			}, nil, true
+		}
+		if c.cursor < len(s.events) {
+			e := s.events[c.cursor]
+			c.cursor++
+			s.mutex.Unlock()
+
+			if e.block != nil {
+				return map[string]interface{}{
+					"direction": chainsync.RollForwardString,
+					"block":     e.block,
+					"tip":       current,
+				}, nil, true
+			}
+			return map[string]interface{}{
+				"direction": chainsync.RollBackwardString,
+				"point":     e.point,
+				"tip":       current,
+			}, nil, true
+		}
+		changed := s.changed
+		s.mutex.Unlock()
+
+		if !c.wait(changed) {
+			return nil, nil, false
+		}
+	}
+}
+
+func (c *session) acquireMempool() (interface{}, *Error, bool) {
+	s := c.server
+	for {
+		s.mutex.Lock()
+		if len(s.mempool) > 0 {
+			c.acquired, c.snapshot = true, s.mempool[0]
+			s.mempool = s.mempool[1:]
+			var slot uint64
+			if ps, ok := tip(s.events, len(s.events)).PointStruct(); ok {
+				slot = ps.Slot
+			}
+			s.mutex.Unlock()
+			return map[string]interface{}{"acquired": "mempool", "slot": slot}, nil, true
+		}
+		changed := s.changed
+		s.mutex.Unlock()
+
+		if !c.wait(changed) {
+			return nil, nil, false
+		}
+	}
+}
+
+func (c *session) nextTransaction(params json.RawMessage) (interface{}, *Error) {
+	if !c.acquired {
+		return nil, &Error{Code: CodeMempoolNotAcquired, Message: "mempool must be acquired first"}
+	}
+	if len(c.snapshot) == 0 {
+		return map[string]interface{}{"transaction": nil}, nil
+	}
+
+	tx := c.snapshot[0]
+	c.snapshot = c.snapshot[1:]
+	if fields, _ := jsonparser.GetString(params, "fields"); fields != "all" {
+		id, _ := jsonparser.GetString(tx, "id")
+		return map[string]interface{}{"transaction": map[string]string{"id": id}}, nil
+	}
+	return map[string]interface{}{"transaction": tx}, nil
+}
@@ -41,3 +41,16 @@ func TestWithPipeline(t *testing.T) {
 		t.Fatalf("got %v; want %v", got, want)
 	}
 }
+
+func TestWithHeader(t *testing.T) {
+	options := buildOptions(
+		WithHeader("Dmtr-Api-Key", "abc"),
+		WithHeader("X-Trace", "1"),
+	)
+	if got, want := options.header.Get("Dmtr-Api-Key"), "abc"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := options.header.Get("X-Trace"), "1"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
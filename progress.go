@@ -0,0 +1,171 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogmigo
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync"
+	"github.com/buger/jsonparser"
+)
+
+const (
+	// defaultSyncedSlots is how close to the tip, in slots, a ChainSync must
+	// be to count as synced; roughly two minutes of shelley era slots
+	defaultSyncedSlots = 120
+
+	// rateInterval is the minimum period over which blocks per second is
+	// sampled
+	rateInterval = time.Second
+)
+
+// Progress reports how far a ChainSync has come, derived from the blocks
+// delivered and the tip reported by ogmios alongside each of them
+type Progress struct {
+	Slot            uint64        // Slot of the most recently delivered block or rollback
+	Height          uint64        // Height of the most recently delivered block
+	TipSlot         uint64        // TipSlot reported by ogmios
+	TipHeight       uint64        // TipHeight reported by ogmios
+	Percent         float64       // Percent of the slots up to the tip that have been synced
+	BlocksPerSecond float64       // BlocksPerSecond delivered, smoothed over recent samples
+	ETA             time.Duration // ETA until the tip is reached; 0 once synced or if unknown
+	Synced          bool          // Synced is true within the synced threshold of the tip
+}
+
+// SyncedFunc is invoked each time a ChainSync comes within the synced
+// threshold of the tip, and each time it falls behind again; see
+// Progress.Synced
+type SyncedFunc func(ctx context.Context, progress Progress)
+
+// WithSyncedThreshold sets how close to the tip, in slots, a ChainSync must
+// be to count as synced.  Defaults to 120.
+func WithSyncedThreshold(slots uint64) ChainSyncOption {
+	return func(opts *ChainSyncOptions) {
+		opts.syncedSlots = slots
+	}
+}
+
+// WithSyncedFunc invokes fn on each transition between catching up and
+// following the tip.  fn is called from the ChainSync goroutine, before the
+// next block is delivered.
+func WithSyncedFunc(fn SyncedFunc) ChainSyncOption {
+	return func(opts *ChainSyncOptions) {
+		opts.synced = fn
+	}
+}
+
+// Progress returns the current progress of the ChainSync.  Progress is safe
+// to call concurrently e.g. from a readiness probe.
+func (c *ChainSync) Progress() Progress {
+	return c.progress.get()
+}
+
+// syncProgress tracks the Progress of a ChainSync across reconnects
+type syncProgress struct {
+	threshold uint64
+	now       func() time.Time
+
+	mutex    sync.Mutex
+	progress Progress
+	since    time.Time // start of the current rate sample
+	blocks   int       // blocks delivered in the current rate sample
+}
+
+func newSyncProgress(threshold uint64) *syncProgress {
+	return &syncProgress{
+		threshold: threshold,
+		now:       time.Now,
+	}
+}
+
+func (s *syncProgress) get() Progress {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.progress
+}
+
+// update records the delivered message and reports whether it changed
+// whether the ChainSync is synced.  As with observeNextBlock, the fields are
+// read with jsonparser so ChainSync need not decode each block.
+func (s *syncProgress) update(data []byte) (Progress, bool) {
+	result, _, _, err := jsonparser.Get(data, "result")
+	if err != nil {
+		return Progress{}, false
+	}
+	direction, _ := jsonparser.GetString(result, "direction")
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	p := &s.progress
+	if tipSlot, err := jsonparser.GetInt(result, "tip", "slot"); err == nil {
+		tipHeight, _ := jsonparser.GetInt(result, "tip", "height")
+		p.TipSlot, p.TipHeight = uint64(tipSlot), uint64(tipHeight)
+	}
+	switch direction {
+	case chainsync.RollForwardString:
+		slot, _ := jsonparser.GetInt(result, "block", "slot")
+		height, _ := jsonparser.GetInt(result, "block", "height")
+		p.Slot, p.Height = uint64(slot), uint64(height)
+		s.sample()
+	case chainsync.RollBackwardString:
+		slot, _ := jsonparser.GetInt(result, "point", "slot") // origin has no slot
+		p.Slot = uint64(slot)
+	default:
+		return Progress{}, false
+	}
+
+	p.Percent, p.ETA = 100, 0
+	if p.Slot < p.TipSlot {
+		p.Percent = 100 * float64(p.Slot) / float64(p.TipSlot)
+	}
+	if p.Height < p.TipHeight && p.BlocksPerSecond > 0 {
+		p.ETA = time.Duration(float64(p.TipHeight-p.Height) / p.BlocksPerSecond * float64(time.Second))
+	}
+
+	synced := p.TipSlot > 0 && p.Slot+s.threshold >= p.TipSlot
+	if synced {
+		p.ETA = 0
+	}
+	changed := synced != p.Synced
+	p.Synced = synced
+	return *p, changed
+}
+
+// sample counts a delivered block, folding the rate of each completed sample
+// into BlocksPerSecond
+func (s *syncProgress) sample() {
+	now := s.now()
+	if s.since.IsZero() {
+		s.since = now
+		return
+	}
+
+	s.blocks++
+	elapsed := now.Sub(s.since)
+	if elapsed < rateInterval {
+		return
+	}
+
+	rate := float64(s.blocks) / elapsed.Seconds()
+	if p := &s.progress; p.BlocksPerSecond == 0 {
+		p.BlocksPerSecond = rate
+	} else {
+		p.BlocksPerSecond = 0.7*p.BlocksPerSecond + 0.3*rate
+	}
+	s.since, s.blocks = now, 0
+}
@@ -0,0 +1,131 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogmigo
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSyncProgress_update(t *testing.T) {
+	var (
+		progress = newSyncProgress(20)
+		now      = time.Unix(0, 0)
+	)
+	progress.now = func() time.Time {
+		now = now.Add(500 * time.Millisecond)
+		return now
+	}
+
+	forward := func(slot uint64) []byte {
+		return []byte(fmt.Sprintf(
+			`{"jsonrpc":"2.0","method":"nextBlock","result":{"direction":"forward","block":{"id":"a","slot":%v,"height":%v},"tip":{"slot":100,"id":"tip","height":10}}}`,
+			slot,
+			slot/10,
+		))
+	}
+	backward := []byte(`{"jsonrpc":"2.0","method":"nextBlock","result":{"direction":"backward","point":{"slot":70,"id":"a"},"tip":{"slot":100,"id":"tip","height":10}}}`)
+
+	tests := []struct {
+		data    []byte
+		synced  bool
+		changed bool
+	}{
+		{data: forward(10)},
+		{data: forward(20)},
+		{data: forward(30)},
+		{data: forward(80), synced: true, changed: true},
+		{data: forward(90), synced: true},
+		{data: backward, changed: true},
+		{data: []byte(`{"jsonrpc":"2.0","method":"findIntersection","result":{"intersection":"origin"}}`)},
+	}
+	for i, tc := range tests {
+		got, changed := progress.update(tc.data)
+		if changed != tc.changed {
+			t.Fatalf("%v: got %v; want %v", i, changed, tc.changed)
+		}
+		if got := progress.get(); got.Synced != tc.synced {
+			t.Fatalf("%v: got %v; want %v", i, got.Synced, tc.synced)
+		}
+
+		// two blocks over a second give 2 blocks per second; the tip is 7 blocks away
+		if i == 2 {
+			if got.BlocksPerSecond != 2 {
+				t.Fatalf("got %v; want 2", got.BlocksPerSecond)
+			}
+			if got.ETA != 3500*time.Millisecond {
+				t.Fatalf("got %v; want 3.5s", got.ETA)
+			}
+			if got.Percent != 30 {
+				t.Fatalf("got %v; want 30", got.Percent)
+			}
+		}
+	}
+
+	got := progress.get()
+	if got.Slot != 70 || got.Height != 9 || got.TipSlot != 100 || got.TipHeight != 10 {
+		t.Fatalf("got %#v; want slot 70, height 9, tip 100/10", got)
+	}
+}
+
+func TestChainSync_Progress(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := New(
+		WithTransport(NewMemoryTransport(memoryOgmios(10))),
+		WithLogger(NopLogger),
+	)
+	defer client.Close()
+
+	var (
+		mutex       sync.Mutex
+		transitions []bool
+		synced      = make(chan struct{})
+	)
+	onSynced := func(_ context.Context, progress Progress) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		transitions = append(transitions, progress.Synced)
+		close(synced)
+	}
+	callback := func(context.Context, []byte) error { return nil }
+
+	closer, err := client.ChainSync(ctx, callback, WithSyncedThreshold(0), WithSyncedFunc(onSynced))
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	defer closer.Close()
+
+	select {
+	case <-ctx.Done():
+		t.Fatalf("got %#v; want synced", closer.Progress())
+	case <-synced:
+	}
+
+	got := closer.Progress()
+	if !got.Synced || got.Slot != 100 || got.Height != 10 || got.TipSlot != 100 || got.Percent != 100 {
+		t.Fatalf("got %#v; want synced at slot 100", got)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(transitions) != 1 || !transitions[0] {
+		t.Fatalf("got %v; want [true]", transitions)
+	}
+}
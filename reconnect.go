@@ -0,0 +1,224 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogmigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ReconnectPolicy controls how ChainSync and MonitorMempool reconnect to
+// ogmios after the connection drops
+type ReconnectPolicy struct {
+	// InitialDelay before the first reconnect attempt
+	InitialDelay time.Duration
+	// MaxDelay caps the delay between attempts; 0 for no cap
+	MaxDelay time.Duration
+	// Multiplier applied to the delay after each consecutive failed attempt;
+	// values below 1 keep the delay constant
+	Multiplier float64
+	// Jitter randomizes each delay by up to +/- the given fraction e.g. 0.2
+	Jitter float64
+	// MaxAttempts is the number of consecutive attempts before giving up; 0
+	// retries forever.  The count resets once a connection is established.
+	MaxAttempts int
+	// Retryable decides whether an error warrants a reconnect; defaults to
+	// IsTemporaryError
+	Retryable func(err error) bool
+	// OnReconnect, if set, is invoked before each reconnect attempt
+	OnReconnect func(attempt int, delay time.Duration, err error)
+}
+
+// DefaultReconnectPolicy retries every 10s, forever
+var DefaultReconnectPolicy = ReconnectPolicy{
+	InitialDelay: 10 * time.Second,
+	MaxDelay:     10 * time.Second,
+	Multiplier:   1,
+}
+
+// ExponentialReconnectPolicy doubles the delay from initial up to max,
+// with 20% jitter, and retries forever
+func ExponentialReconnectPolicy(initial, max time.Duration) ReconnectPolicy {
+	return ReconnectPolicy{
+		InitialDelay: initial,
+		MaxDelay:     max,
+		Multiplier:   2,
+		Jitter:       0.2,
+	}
+}
+
+// Delay returns the delay to wait before the given attempt, starting from 1
+func (p ReconnectPolicy) Delay(attempt int) time.Duration {
+	delay := float64(p.InitialDelay)
+	if p.Multiplier > 1 && attempt > 1 {
+		delay *= math.Pow(p.Multiplier, float64(attempt-1))
+	}
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+	if delay < 0 {
+		return 0
+	}
+	return time.Duration(delay)
+}
+
+func (p ReconnectPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsTemporaryError(err)
+}
+
+// reconnect invokes fn until it returns an error the policy considers
+// permanent, gives up or the context is done.  fn calls connected once it
+// has established a connection, resetting the attempt count.
+func (c *Client) reconnect(
+	ctx context.Context,
+	protocol string,
+	enabled bool,
+	fn func(ctx context.Context, connected func()) error,
+) error {
+	var (
+		policy  = c.options.reconnectPolicy
+		attempt int
+	)
+	for {
+		err := fn(ctx, func() { attempt = 0 })
+		if err == nil || !enabled || !policy.retryable(err) {
+			return err
+		}
+
+		attempt++
+		if policy.MaxAttempts > 0 && attempt > policy.MaxAttempts {
+			return fmt.Errorf(
+				"giving up after %v reconnect attempts: %w",
+				policy.MaxAttempts,
+				err,
+			)
+		}
+
+		delay := policy.Delay(attempt)
+		c.options.logger.Info(
+			"websocket connection error: will retry",
+			KV("attempt", strconv.Itoa(attempt)),
+			KV("delay", delay.Round(time.Millisecond).String()),
+			KV("err", err.Error()),
+		)
+		if policy.OnReconnect != nil {
+			policy.OnReconnect(attempt, delay, err)
+		}
+		if c.observing() {
+			c.observe(ctx, ReconnectEvent{
+				Protocol: protocol,
+				Attempt:  attempt,
+				Delay:    delay,
+				Err:      err,
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+	}
+}
+
+// IsTemporaryError returns true if the error is recoverable by reconnecting
+// e.g. dropped connections, refused connections, server restarts, timeouts
+// and DNS failures
+func IsTemporaryError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	wce := &websocket.CloseError{}
+	if ok := errors.As(err, &wce); ok {
+		switch wce.Code {
+		case websocket.CloseGoingAway,
+			websocket.CloseAbnormalClosure,
+			websocket.CloseInternalServerErr,
+			websocket.CloseServiceRestart,
+			websocket.CloseTryAgainLater:
+			return true
+		default:
+			return false
+		}
+	}
+
+	// connection dropped mid-handshake or mid-stream
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	// handshake timeouts
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var dns *net.DNSError
+	if ok := errors.As(err, &dns); ok {
+		return true
+	}
+
+	for _, errno := range []syscall.Errno{
+		syscall.ECONNREFUSED,
+		syscall.ECONNRESET,
+		syscall.ECONNABORTED,
+		syscall.EPIPE,
+		syscall.ETIMEDOUT,
+		syscall.EHOSTUNREACH,
+		syscall.ENETUNREACH,
+	} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+
+	noe := &net.OpError{}
+	if ok := errors.As(err, &noe); ok {
+		sce := &os.SyscallError{}
+		if ok := errors.As(noe.Err, &sce); ok && sce.Syscall == "connect" {
+			return true
+		}
+		if noe.Timeout() {
+			return true
+		}
+		//nolint:staticcheck
+		return noe.Temporary()
+	}
+
+	// handle the generic temporary error
+	var temp interface{ Temporary() bool }
+	if ok := errors.As(err, &temp); ok {
+		return temp.Temporary()
+	}
+
+	return false
+}
@@ -0,0 +1,198 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogmigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestReconnectPolicy_Delay(t *testing.T) {
+	policy := ReconnectPolicy{
+		InitialDelay: time.Second,
+		MaxDelay:     10 * time.Second,
+		Multiplier:   2,
+	}
+	for attempt, want := range []time.Duration{
+		1: time.Second,
+		2: 2 * time.Second,
+		3: 4 * time.Second,
+		4: 8 * time.Second,
+		5: 10 * time.Second,
+		6: 10 * time.Second,
+	} {
+		if attempt == 0 {
+			continue
+		}
+		if got := policy.Delay(attempt); got != want {
+			t.Fatalf("attempt %v: got %v; want %v", attempt, got, want)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := policy.Delay(1); got < 500*time.Millisecond || got > 1500*time.Millisecond {
+			t.Fatalf("got %v; want within 50%% of 1s", got)
+		}
+	}
+}
+
+func TestIsTemporaryError(t *testing.T) {
+	tests := map[string]struct {
+		Err  error
+		Want bool
+	}{
+		"nil": {
+			Err:  nil,
+			Want: false,
+		},
+		"going away": {
+			Err:  &websocket.CloseError{Code: websocket.CloseGoingAway},
+			Want: true,
+		},
+		"abnormal closure": {
+			Err:  fmt.Errorf("read: %w", &websocket.CloseError{Code: websocket.CloseAbnormalClosure}),
+			Want: true,
+		},
+		"normal closure": {
+			Err:  &websocket.CloseError{Code: websocket.CloseNormalClosure},
+			Want: false,
+		},
+		"eof during handshake": {
+			Err:  fmt.Errorf("failed to connect to ogmios: %w", io.ErrUnexpectedEOF),
+			Want: true,
+		},
+		"dns": {
+			Err:  &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "ogmios", IsNotFound: true}},
+			Want: true,
+		},
+		"connection refused": {
+			Err:  &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)},
+			Want: true,
+		},
+		"connection reset": {
+			Err:  &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)},
+			Want: true,
+		},
+		"canceled": {
+			Err:  fmt.Errorf("failed to connect: %w", context.Canceled),
+			Want: false,
+		},
+		"callback": {
+			Err:  errors.New("chainsync stopped: callback failed"),
+			Want: false,
+		},
+	}
+
+	for label, tc := range tests {
+		t.Run(label, func(t *testing.T) {
+			if got := IsTemporaryError(tc.Err); got != tc.Want {
+				t.Fatalf("got %v; want %v", got, tc.Want)
+			}
+		})
+	}
+}
+
+// flakyTransport refuses the first failures dials before deferring to next
+type flakyTransport struct {
+	failures int64
+	next     Transport
+}
+
+func (f *flakyTransport) Dial(ctx context.Context, endpoint string) (Conn, error) {
+	if atomic.AddInt64(&f.failures, -1) >= 0 {
+		return nil, &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	}
+	return f.next.Dial(ctx, endpoint)
+}
+
+func TestClient_ChainSyncReconnect(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	t.Run("recovers", func(t *testing.T) {
+		var attempts int64
+		client := New(
+			WithTransport(&flakyTransport{failures: 2, next: NewMemoryTransport(memoryOgmios(1))}),
+			WithLogger(NopLogger),
+			WithReconnectPolicy(ReconnectPolicy{
+				InitialDelay: time.Millisecond,
+				Multiplier:   2,
+				OnReconnect: func(int, time.Duration, error) {
+					atomic.AddInt64(&attempts, 1)
+				},
+			}),
+		)
+
+		received := make(chan struct{})
+		callback := func(context.Context, []byte) error {
+			select {
+			case received <- struct{}{}:
+			default:
+			}
+			return nil
+		}
+		closer, err := client.ChainSync(ctx, callback, WithReconnect(true))
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		defer closer.Close()
+
+		select {
+		case <-received:
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for chainsync")
+		}
+		if got, want := atomic.LoadInt64(&attempts), int64(2); got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("gives up", func(t *testing.T) {
+		client := New(
+			WithTransport(&flakyTransport{failures: 100}),
+			WithLogger(NopLogger),
+			WithReconnectPolicy(ReconnectPolicy{
+				InitialDelay: time.Millisecond,
+				MaxAttempts:  3,
+			}),
+		)
+
+		callback := func(context.Context, []byte) error { return nil }
+		closer, err := client.ChainSync(ctx, callback, WithReconnect(true))
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+
+		select {
+		case <-closer.Done():
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for chainsync to give up")
+		}
+		if err := closer.Close(); !errors.Is(err, syscall.ECONNREFUSED) {
+			t.Fatalf("got %v; want ECONNREFUSED", err)
+		}
+	})
+}
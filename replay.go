@@ -0,0 +1,361 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogmigo
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/buger/jsonparser"
+	"github.com/gorilla/websocket"
+)
+
+// Frame is a single message exchanged with ogmios, as written by the
+// recording transport; one Frame is written per line
+type Frame struct {
+	Conn      int             `json:"conn"`           // Conn numbers the connections of the session from 1
+	Direction Direction       `json:"direction"`      // Direction of the message
+	Data      json.RawMessage `json:"data,omitempty"` // Data holds the message when it is valid json
+	Text      string          `json:"text,omitempty"` // Text holds the message otherwise
+}
+
+func (f Frame) message() []byte {
+	if f.Data != nil {
+		return f.Data
+	}
+	return []byte(f.Text)
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (d Direction) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (d *Direction) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "outbound":
+		*d = Outbound
+	case "inbound":
+		*d = Inbound
+	default:
+		return fmt.Errorf("invalid direction, %v", string(text))
+	}
+	return nil
+}
+
+type recordingTransport struct {
+	next Transport
+
+	mutex sync.Mutex
+	enc   *json.Encoder
+	conns int
+	err   error
+}
+
+// NewRecordingTransport returns a Transport that connects via next and writes
+// every text message exchanged, in both directions, to w as JSONL.  The
+// recording can be served back to a Client by NewReplayTransport.
+func NewRecordingTransport(next Transport, w io.Writer) Transport {
+	return &recordingTransport{
+		next: next,
+		enc:  json.NewEncoder(w),
+	}
+}
+
+func (r *recordingTransport) Dial(ctx context.Context, endpoint string) (Conn, error) {
+	conn, err := r.next.Dial(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mutex.Lock()
+	r.conns++
+	id := r.conns
+	r.mutex.Unlock()
+
+	return &recordingConn{Conn: conn, transport: r, id: id}, nil
+}
+
+func (r *recordingTransport) record(id int, direction Direction, messageType int, data []byte) error {
+	if messageType != websocket.TextMessage {
+		return nil
+	}
+
+	frame := Frame{Conn: id, Direction: direction}
+	if json.Valid(data) {
+		frame.Data = data
+	} else {
+		frame.Text = string(data)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.err == nil {
+		if err := r.enc.Encode(frame); err != nil {
+			r.err = fmt.Errorf("failed to record frame: %w", err)
+		}
+	}
+	return r.err
+}
+
+type recordingConn struct {
+	Conn
+	transport *recordingTransport
+	id        int
+}
+
+func (r *recordingConn) ReadMessage() (int, []byte, error) {
+	messageType, data, err := r.Conn.ReadMessage()
+	if err != nil {
+		return messageType, data, err
+	}
+	if err := r.transport.record(r.id, Inbound, messageType, data); err != nil {
+		return 0, nil, err
+	}
+	return messageType, data, nil
+}
+
+func (r *recordingConn) WriteMessage(messageType int, data []byte) error {
+	if err := r.transport.record(r.id, Outbound, messageType, data); err != nil {
+		return err
+	}
+	return r.Conn.WriteMessage(messageType, data)
+}
+
+// errReplayExhausted indicates no recorded connection matches the request
+var errReplayExhausted = errors.New("replay: no recorded connection matches request")
+
+type replayTransport struct {
+	mutex    sync.Mutex
+	sessions [][]Frame // recorded connections not yet replayed
+}
+
+// NewReplayTransport returns a Transport that serves a recording made by
+// NewRecordingTransport back to the Client without any network.  Each
+// connection is bound to the first unused recorded connection that began
+// with the same method.  As the client writes each recorded request, the
+// responses that followed it in the recording are delivered, with request
+// ids, or the mirror reflected by ogmios v5, rewritten to match.  Replay is
+// deterministic provided the client sends the same requests in the same
+// order e.g. uses the same pipeline setting; any divergence fails the write.
+func NewReplayTransport(r io.Reader) (Transport, error) {
+	sessions := map[int][]Frame{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var frame Frame
+		if err := json.Unmarshal(scanner.Bytes(), &frame); err != nil {
+			return nil, fmt.Errorf("failed to read frame on line %v: %w", line, err)
+		}
+		sessions[frame.Conn] = append(sessions[frame.Conn], frame)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read recording: %w", err)
+	}
+
+	var ids []int
+	for id := range sessions {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	transport := &replayTransport{}
+	for _, id := range ids {
+		transport.sessions = append(transport.sessions, sessions[id])
+	}
+	return transport, nil
+}
+
+func (r *replayTransport) Dial(ctx context.Context, _ string) (Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return &replayConn{
+		transport: r,
+		ids:       map[string][]byte{},
+		ready:     make(chan struct{}, 1),
+		closed:    make(chan struct{}),
+	}, nil
+}
+
+// claim removes and returns the first recorded connection that begins with
+// an outbound message for method
+func (r *replayTransport) claim(method string) ([]Frame, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i, session := range r.sessions {
+		for _, frame := range session {
+			if frame.Direction != Outbound {
+				continue
+			}
+			if methodOf(frame.message()) == method {
+				r.sessions = append(r.sessions[:i], r.sessions[i+1:]...)
+				return session, true
+			}
+			break
+		}
+	}
+	return nil, false
+}
+
+type replayConn struct {
+	transport *replayTransport
+
+	mutex   sync.Mutex
+	session []Frame
+	pos     int
+	ids     map[string][]byte // recorded request id to live request id
+	pending [][]byte          // inbound messages awaiting delivery
+
+	ready  chan struct{} // signals pending messages are available
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (r *replayConn) ReadMessage() (int, []byte, error) {
+	for {
+		r.mutex.Lock()
+		if len(r.pending) > 0 {
+			data := r.pending[0]
+			r.pending = r.pending[1:]
+			r.mutex.Unlock()
+			return websocket.TextMessage, data, nil
+		}
+		r.mutex.Unlock()
+
+		select {
+		case <-r.ready:
+		case <-r.closed:
+			return 0, nil, io.EOF
+		}
+	}
+}
+
+func (r *replayConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != websocket.TextMessage {
+		return nil
+	}
+
+	select {
+	case <-r.closed:
+		return io.ErrClosedPipe
+	default:
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	method := methodOf(data)
+	if r.session == nil {
+		session, ok := r.transport.claim(method)
+		if !ok {
+			return fmt.Errorf("%w, %v", errReplayExhausted, method)
+		}
+		r.session = session
+	}
+
+	for r.pos < len(r.session) && r.session[r.pos].Direction == Inbound {
+		r.pos++ // responses recorded ahead of any request
+	}
+	if r.pos == len(r.session) {
+		return fmt.Errorf("%w, %v: recording ended", errReplayExhausted, method)
+	}
+
+	frame := r.session[r.pos]
+	if want := methodOf(frame.message()); want != method {
+		return fmt.Errorf("replay diverged: got %v; want %v", method, want)
+	}
+	r.pos++
+
+	if recorded, ok := lookup(frame.message(), "id", "mirror"); ok {
+		if live, ok := lookup(data, "id", "mirror"); ok {
+			r.ids[string(recorded)] = append([]byte(nil), live...)
+		}
+	}
+
+	for ; r.pos < len(r.session) && r.session[r.pos].Direction == Inbound; r.pos++ {
+		r.pending = append(r.pending, r.rewrite(r.session[r.pos].message()))
+	}
+	r.notify()
+	return nil
+}
+
+// rewrite replaces the recorded request id of an inbound message, or the
+// reflection of an ogmios v5 message, with the live request id
+func (r *replayConn) rewrite(data []byte) []byte {
+	for _, key := range []string{"id", "reflection"} {
+		recorded, ok := lookup(data, key)
+		if !ok {
+			continue
+		}
+		live, ok := r.ids[string(recorded)]
+		if !ok || string(live) == string(recorded) {
+			return data
+		}
+		if v, err := jsonparser.Set(append([]byte(nil), data...), live, key); err == nil {
+			return v
+		}
+		return data
+	}
+	return data
+}
+
+// methodOf returns the method of a message, which ogmios v5 calls methodname
+func methodOf(data []byte) string {
+	if method, err := jsonparser.GetString(data, "method"); err == nil {
+		return method
+	}
+	method, _ := jsonparser.GetString(data, "methodname")
+	return method
+}
+
+// lookup returns the value of the first of keys present in data, other than
+// null
+func lookup(data []byte, keys ...string) ([]byte, bool) {
+	for _, key := range keys {
+		if v, dataType, _, err := jsonparser.Get(data, key); err == nil && dataType != jsonparser.Null {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// notify wakes the reader, if waiting
+func (r *replayConn) notify() {
+	select {
+	case r.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (r *replayConn) SetWriteDeadline(time.Time) error { return nil }
+
+func (r *replayConn) Close() error {
+	r.once.Do(func() { close(r.closed) })
+	return nil
+}
@@ -0,0 +1,148 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogmigo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// session queries the tip then follows the chain until n messages arrive
+func session(ctx context.Context, t *testing.T, client *Client, n int) (uint64, []string) {
+	tip, err := client.ChainTip(ctx)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	ps, _ := tip.PointStruct()
+
+	var messages []string
+	done := make(chan struct{})
+	callback := func(ctx context.Context, data []byte) error {
+		messages = append(messages, string(data))
+		if len(messages) == n {
+			close(done)
+		}
+		return nil
+	}
+	closer, err := client.ChainSync(ctx, callback)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	defer func() {
+		_ = closer.Close()
+		<-closer.Done()
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatalf("got timeout; want %v messages", n)
+	}
+	return ps.Slot, messages
+}
+
+func TestReplayTransport(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var recording bytes.Buffer
+	recorder := New(
+		WithTransport(NewRecordingTransport(NewMemoryTransport(memoryOgmios(3)), &recording)),
+		WithLogger(NopLogger),
+	)
+	wantSlot, wantMessages := session(ctx, t, recorder, 4)
+	_ = recorder.Close()
+
+	transport, err := NewReplayTransport(bytes.NewReader(recording.Bytes()))
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	replayer := New(
+		WithTransport(transport),
+		WithLogger(NopLogger),
+	)
+	defer replayer.Close()
+	replayer.requestID = 100 // request ids must be rewritten to match
+
+	gotSlot, gotMessages := session(ctx, t, replayer, 4)
+	if gotSlot != wantSlot {
+		t.Fatalf("got %v; want %v", gotSlot, wantSlot)
+	}
+	if !reflect.DeepEqual(gotMessages, wantMessages) {
+		t.Fatalf("got %v; want %v", gotMessages, wantMessages)
+	}
+
+	// the recording has been consumed
+	if _, err := replayer.ChainTip(ctx); !errors.Is(err, errReplayExhausted) {
+		t.Fatalf("got %v; want %v", err, errReplayExhausted)
+	}
+}
+
+func TestReplayTransportV5(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var (
+		rejected  int64
+		recording bytes.Buffer
+	)
+	ogmios := memoryOgmiosV5(&rejected, func(string, json.RawMessage) interface{} {
+		return Map{"slot": 123, "hash": "abc"}
+	})
+	recorder := New(
+		WithTransport(NewRecordingTransport(NewMemoryTransport(ogmios), &recording)),
+		WithLogger(NopLogger),
+	)
+	for i := 0; i < 2; i++ {
+		if _, err := recorder.ChainTip(ctx); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+	}
+	_ = recorder.Close()
+
+	transport, err := NewReplayTransport(bytes.NewReader(recording.Bytes()))
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	replayer := New(
+		WithTransport(transport),
+		WithLogger(NopLogger),
+	)
+	defer replayer.Close()
+	replayer.requestID = 100 // mirrors must be rewritten to match
+
+	for i := 0; i < 2; i++ {
+		point, err := replayer.ChainTip(ctx)
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if ps, ok := point.PointStruct(); !ok || ps.Slot != 123 || ps.ID != "abc" {
+			t.Fatalf("got %v; want slot 123, id abc", point)
+		}
+	}
+	if version, _ := replayer.ServerVersion(ctx); version != Version5 {
+		t.Fatalf("got %v; want %v", version, Version5)
+	}
+
+	// the recording has been consumed
+	if _, err := replayer.ChainTip(ctx); !errors.Is(err, errReplayExhausted) {
+		t.Fatalf("got %v; want %v", err, errReplayExhausted)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"math/big"
 
 	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync"
 	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/num"
@@ -28,7 +29,27 @@ import (
 	"github.com/btcsuite/btcutil/bech32"
 )
 
-func (c *Client) ChainTip(ctx context.Context) (chainsync.Point, error) {
+// ChainTip returns the tip of the ledger; the tip is converted to v6 types
+// when the server runs ogmios v5
+func (c *Client) ChainTip(ctx context.Context) (point chainsync.Point, err error) {
+	err = c.dispatch(ctx,
+		func(ctx context.Context) (err error) {
+			point, err = c.chainTip(ctx)
+			return err
+		},
+		func(ctx context.Context) error {
+			p, err := c.ChainTipV5(ctx)
+			if err != nil {
+				return err
+			}
+			point = p.ConvertToV6()
+			return nil
+		},
+	)
+	return point, err
+}
+
+func (c *Client) chainTip(ctx context.Context) (chainsync.Point, error) {
 	var (
 		payload = makePayload("queryLedgerState/tip", Map{}, nil)
 		content struct{ Result chainsync.Point }
@@ -54,7 +75,22 @@ func (c *Client) ChainTipV5(ctx context.Context) (v5.PointV5, error) {
 	return content.Result, nil
 }
 
-func (c *Client) CurrentEpoch(ctx context.Context) (uint64, error) {
+// CurrentEpoch returns the current epoch number
+func (c *Client) CurrentEpoch(ctx context.Context) (epoch uint64, err error) {
+	err = c.dispatch(ctx,
+		func(ctx context.Context) (err error) {
+			epoch, err = c.currentEpoch(ctx)
+			return err
+		},
+		func(ctx context.Context) error {
+			payload := makePayloadV5("Query", Map{"query": "currentEpoch"})
+			return c.queryResult(ctx, payload, &epoch)
+		},
+	)
+	return epoch, err
+}
+
+func (c *Client) currentEpoch(ctx context.Context) (uint64, error) {
 	var (
 		payload = makePayload("queryLedgerState/epoch", Map{}, nil)
 		content struct{ Result uint64 }
@@ -67,8 +103,24 @@ func (c *Client) CurrentEpoch(ctx context.Context) (uint64, error) {
 	return content.Result, nil
 }
 
+// CurrentProtocolParameters returns the protocol parameters in the ogmios v6
+// representation; requires ogmios v6.  Use CurrentProtocolParametersV5 for
+// the v5 representation.
 func (c *Client) CurrentProtocolParameters(
 	ctx context.Context,
+) (params json.RawMessage, err error) {
+	err = c.dispatch(ctx,
+		func(ctx context.Context) (err error) {
+			params, err = c.currentProtocolParameters(ctx)
+			return err
+		},
+		nil,
+	)
+	return params, err
+}
+
+func (c *Client) currentProtocolParameters(
+	ctx context.Context,
 ) (json.RawMessage, error) {
 	var (
 		payload = makePayload("queryLedgerState/protocolParameters", Map{}, nil)
@@ -100,9 +152,25 @@ func (c *Client) CurrentProtocolParametersV5(
 	return content.Result, nil
 }
 
+// GenesisConfig returns the genesis configuration of the era; requires
+// ogmios v6
 func (c *Client) GenesisConfig(
 	ctx context.Context,
 	era string,
+) (config json.RawMessage, err error) {
+	err = c.dispatch(ctx,
+		func(ctx context.Context) (err error) {
+			config, err = c.genesisConfig(ctx, era)
+			return err
+		},
+		nil,
+	)
+	return config, err
+}
+
+func (c *Client) genesisConfig(
+	ctx context.Context,
+	era string,
 ) (json.RawMessage, error) {
 	var (
 		payload = makePayload(
@@ -120,7 +188,22 @@ func (c *Client) GenesisConfig(
 	return content.Result, nil
 }
 
-func (c *Client) StartTime(ctx context.Context) (string, error) {
+// StartTime returns the start time of the network
+func (c *Client) StartTime(ctx context.Context) (start string, err error) {
+	err = c.dispatch(ctx,
+		func(ctx context.Context) (err error) {
+			start, err = c.startTime(ctx)
+			return err
+		},
+		func(ctx context.Context) error {
+			payload := makePayloadV5("Query", Map{"query": "systemStart"})
+			return c.queryResult(ctx, payload, &start)
+		},
+	)
+	return start, err
+}
+
+func (c *Client) startTime(ctx context.Context) (string, error) {
 	var (
 		payload = makePayload("queryNetwork/startTime", nil, nil)
 		content struct{ Result string }
@@ -131,7 +214,22 @@ func (c *Client) StartTime(ctx context.Context) (string, error) {
 	return content.Result, nil
 }
 
-func (c *Client) BlockHeight(ctx context.Context) (uint64, error) {
+// BlockHeight returns the height of the most recent block
+func (c *Client) BlockHeight(ctx context.Context) (height uint64, err error) {
+	err = c.dispatch(ctx,
+		func(ctx context.Context) (err error) {
+			height, err = c.blockHeight(ctx)
+			return err
+		},
+		func(ctx context.Context) error {
+			payload := makePayloadV5("Query", Map{"query": "blockHeight"})
+			return c.queryResult(ctx, payload, &height)
+		},
+	)
+	return height, err
+}
+
+func (c *Client) blockHeight(ctx context.Context) (uint64, error) {
 	var (
 		payload = makePayload("queryNetwork/blockHeight", nil, nil)
 		content struct{ Result uint64 }
@@ -164,7 +262,22 @@ type EraParameters struct {
 	SafeZone    uint64                     `json:"safeZone"`
 }
 
-func (c *Client) EraSummaries(ctx context.Context) (*EraHistory, error) {
+// EraSummaries returns the era history of the network
+func (c *Client) EraSummaries(ctx context.Context) (history *EraHistory, err error) {
+	err = c.dispatch(ctx,
+		func(ctx context.Context) (err error) {
+			history, err = c.eraSummaries(ctx)
+			return err
+		},
+		func(ctx context.Context) (err error) {
+			history, err = c.eraSummariesV5(ctx)
+			return err
+		},
+	)
+	return history, err
+}
+
+func (c *Client) eraSummaries(ctx context.Context) (*EraHistory, error) {
 	var (
 		payload = makePayload("queryLedgerState/eraSummaries", Map{}, nil)
 		content struct{ Result json.RawMessage }
@@ -207,7 +320,22 @@ func SlotToElapsedMilliseconds(history *EraHistory, slot uint64) uint64 {
 	return totalMsElapsed
 }
 
-func (c *Client) EraStart(ctx context.Context) (statequery.EraStart, error) {
+// EraStart returns the start of the current era
+func (c *Client) EraStart(ctx context.Context) (start statequery.EraStart, err error) {
+	err = c.dispatch(ctx,
+		func(ctx context.Context) (err error) {
+			start, err = c.eraStart(ctx)
+			return err
+		},
+		func(ctx context.Context) (err error) {
+			start, err = c.eraStartV5(ctx)
+			return err
+		},
+	)
+	return start, err
+}
+
+func (c *Client) eraStart(ctx context.Context) (statequery.EraStart, error) {
 	var (
 		payload = makePayload("queryLedgerState/eraStart", Map{}, nil)
 		content struct{ Result statequery.EraStart }
@@ -220,9 +348,30 @@ func (c *Client) EraStart(ctx context.Context) (statequery.EraStart, error) {
 	return content.Result, nil
 }
 
+// UtxosByAddress returns the unspent outputs locked by the addresses
 func (c *Client) UtxosByAddress(
 	ctx context.Context,
 	addresses ...string,
+) (utxos []shared.Utxo, err error) {
+	err = c.dispatch(ctx,
+		func(ctx context.Context) (err error) {
+			utxos, err = c.utxosByAddress(ctx, addresses...)
+			return err
+		},
+		func(ctx context.Context) (err error) {
+			utxos, err = c.utxosV5(ctx, addresses)
+			if err != nil {
+				return fmt.Errorf("failed to query utxos by address: %w", err)
+			}
+			return nil
+		},
+	)
+	return utxos, err
+}
+
+func (c *Client) utxosByAddress(
+	ctx context.Context,
+	addresses ...string,
 ) ([]shared.Utxo, error) {
 	var (
 		payload = makePayload(
@@ -240,9 +389,38 @@ func (c *Client) UtxosByAddress(
 	return content.Result, nil
 }
 
+// UtxosByTxIn returns the unspent outputs referenced by txIns; outputs that
+// have been spent are omitted
 func (c *Client) UtxosByTxIn(
 	ctx context.Context,
 	txIns ...chainsync.TxInQuery,
+) (utxos []shared.Utxo, err error) {
+	err = c.dispatch(ctx,
+		func(ctx context.Context) (err error) {
+			utxos, err = c.utxosByTxIn(ctx, txIns...)
+			return err
+		},
+		func(ctx context.Context) (err error) {
+			refs := make([]v5.TxInV5, 0, len(txIns))
+			for _, txIn := range txIns {
+				refs = append(refs, v5.TxInV5{
+					TxHash: txIn.Transaction.ID,
+					Index:  int(txIn.Index),
+				})
+			}
+			utxos, err = c.utxosV5(ctx, refs)
+			if err != nil {
+				return fmt.Errorf("failed to query utxos by tx in: %w", err)
+			}
+			return nil
+		},
+	)
+	return utxos, err
+}
+
+func (c *Client) utxosByTxIn(
+	ctx context.Context,
+	txIns ...chainsync.TxInQuery,
 ) ([]shared.Utxo, error) {
 	var (
 		payload = makePayload(
@@ -275,22 +453,51 @@ type rewardAccountSummary struct {
 	Deposit  *shared.Value `json:"deposit,omitempty"`
 }
 
+// GetDelegation returns the pool the reward address delegates to along with
+// its unclaimed rewards
 func (c *Client) GetDelegation(
 	ctx context.Context,
 	rewardAddress string,
-) (Delegation, error) {
+) (delegation Delegation, err error) {
+	err = c.dispatch(ctx,
+		func(ctx context.Context) (err error) {
+			delegation, err = c.getDelegation(ctx, rewardAddress)
+			return err
+		},
+		func(ctx context.Context) (err error) {
+			delegation, err = c.getDelegationV5(ctx, rewardAddress)
+			return err
+		},
+	)
+	return delegation, err
+}
 
+// rewardAccountKey returns the hex encoded credential of the reward address
+func rewardAccountKey(rewardAddress string) (string, error) {
 	_, data, err := bech32.Decode(rewardAddress)
 	if err != nil {
-		return Delegation{}, fmt.Errorf(
+		return "", fmt.Errorf(
 			"failed to decode reward address: %w",
 			err,
 		)
 	}
 
 	decoded_value, _ := bech32.ConvertBits(data, 5, 8, false)
+	if len(decoded_value) < 2 {
+		return "", fmt.Errorf("failed to decode reward address: too short")
+	}
 
-	rewardAddressVfk := hex.EncodeToString(decoded_value[1:])
+	return hex.EncodeToString(decoded_value[1:]), nil
+}
+
+func (c *Client) getDelegation(
+	ctx context.Context,
+	rewardAddress string,
+) (Delegation, error) {
+	rewardAddressVfk, err := rewardAccountKey(rewardAddress)
+	if err != nil {
+		return Delegation{}, err
+	}
 
 	var (
 		payload = makePayload(
@@ -310,7 +517,17 @@ func (c *Client) GetDelegation(
 		)
 	}
 
-	summary, ok := content.Result[rewardAddressVfk]
+	return delegationOf(rewardAddress, rewardAddressVfk, content.Result)
+}
+
+// delegationOf returns the Delegation held by the reward account summaries
+// for the reward address, whose credential is rewardAddressVfk
+func delegationOf(
+	rewardAddress string,
+	rewardAddressVfk string,
+	summaries map[string]*rewardAccountSummary,
+) (Delegation, error) {
+	summary, ok := summaries[rewardAddressVfk]
 	if !ok || summary == nil {
 		if !ok {
 			return Delegation{
@@ -342,3 +559,200 @@ func (c *Client) GetDelegation(
 
 	return delegation, nil
 }
+
+// queryResult unmarshals the result of the v5 query into v
+func (c *Client) queryResult(ctx context.Context, payload Map, v interface{}) error {
+	var content struct{ Result json.RawMessage }
+	if err := c.query(ctx, payload, &content); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(content.Result, v); err != nil {
+		return fmt.Errorf("failed to unmarshal result: %w", err)
+	}
+	return nil
+}
+
+type eraBoundV5 struct {
+	Time  json.Number `json:"time"`
+	Slot  json.Number `json:"slot"`
+	Epoch json.Number `json:"epoch"`
+}
+
+type eraSummaryV5 struct {
+	Start      eraBoundV5 `json:"start"`
+	End        eraBoundV5 `json:"end"`
+	Parameters struct {
+		EpochLength uint64      `json:"epochLength"`
+		SlotLength  json.Number `json:"slotLength"`
+		SafeZone    uint64      `json:"safeZone"`
+	} `json:"parameters"`
+}
+
+func (c *Client) eraSummariesV5(ctx context.Context) (*EraHistory, error) {
+	var (
+		payload   = makePayloadV5("Query", Map{"query": "eraSummaries"})
+		summaries []eraSummaryV5
+	)
+	if err := c.queryResult(ctx, payload, &summaries); err != nil {
+		return nil, err
+	}
+
+	history := &EraHistory{}
+	for _, s := range summaries {
+		var summary EraSummary
+		if err := s.Start.convert(&summary.Start); err != nil {
+			return nil, err
+		}
+		if err := s.End.convert(&summary.End); err != nil {
+			return nil, err
+		}
+		summary.Parameters.EpochLength = s.Parameters.EpochLength
+		summary.Parameters.SafeZone = s.Parameters.SafeZone
+		err := scaleV5(&summary.Parameters.SlotLength.Milliseconds, s.Parameters.SlotLength, 1000)
+		if err != nil {
+			return nil, err
+		}
+		history.Summaries = append(history.Summaries, summary)
+	}
+	return history, nil
+}
+
+func (b eraBoundV5) convert(bound *EraBound) error {
+	var slot, epoch big.Int
+	for _, v := range []struct {
+		dst *big.Int
+		n   json.Number
+	}{
+		{&bound.Time.Seconds, b.Time},
+		{&slot, b.Slot},
+		{&epoch, b.Epoch},
+	} {
+		if err := scaleV5(v.dst, v.n, 1); err != nil {
+			return err
+		}
+	}
+	bound.Slot, bound.Epoch = slot.Uint64(), epoch.Uint64()
+	return nil
+}
+
+func (c *Client) eraStartV5(ctx context.Context) (statequery.EraStart, error) {
+	var (
+		payload = makePayloadV5("Query", Map{"query": "eraStart"})
+		bound   eraBoundV5
+	)
+	if err := c.queryResult(ctx, payload, &bound); err != nil {
+		return statequery.EraStart{}, err
+	}
+
+	var start statequery.EraStart
+	if err := scaleV5(&start.Time.Seconds, bound.Time, 1); err != nil {
+		return statequery.EraStart{}, err
+	}
+	if err := scaleV5(&start.Slot, bound.Slot, 1); err != nil {
+		return statequery.EraStart{}, err
+	}
+	if err := scaleV5(&start.Epoch, bound.Epoch, 1); err != nil {
+		return statequery.EraStart{}, err
+	}
+	return start, nil
+}
+
+// scaleV5 stores n multiplied by scale in dst, truncating any fraction; v5
+// reports times in seconds, which may be fractional, where v6 reports whole
+// units
+func scaleV5(dst *big.Int, n json.Number, scale int64) error {
+	if n == "" {
+		dst.SetInt64(0)
+		return nil
+	}
+	r, ok := new(big.Rat).SetString(n.String())
+	if !ok {
+		return fmt.Errorf("failed to parse number, %v", n)
+	}
+	r.Mul(r, new(big.Rat).SetInt64(scale))
+	dst.Quo(r.Num(), r.Denom())
+	return nil
+}
+
+// utxosV5 queries the v5 utxo set filtered by addresses or output references
+func (c *Client) utxosV5(ctx context.Context, filter interface{}) ([]shared.Utxo, error) {
+	var (
+		payload = makePayloadV5("Query", Map{"query": Map{"utxo": filter}})
+		pairs   [][2]json.RawMessage
+	)
+	if err := c.queryResult(ctx, payload, &pairs); err != nil {
+		return nil, err
+	}
+
+	utxos := make([]shared.Utxo, 0, len(pairs))
+	for _, pair := range pairs {
+		var (
+			txIn  v5.TxInV5
+			txOut v5.TxOutV5
+		)
+		if err := json.Unmarshal(pair[0], &txIn); err != nil {
+			return nil, fmt.Errorf("failed to decode tx in: %w", err)
+		}
+		if err := json.Unmarshal(pair[1], &txOut); err != nil {
+			return nil, fmt.Errorf("failed to decode tx out: %w", err)
+		}
+
+		out := txOut.ConvertToV6()
+		utxos = append(utxos, shared.Utxo{
+			Transaction: shared.UtxoTxID{ID: txIn.TxHash},
+			Index:       uint32(txIn.Index),
+			Address:     out.Address,
+			Value:       out.Value,
+			DatumHash:   out.DatumHash,
+			Datum:       out.Datum,
+			Script:      out.Script,
+		})
+	}
+	return utxos, nil
+}
+
+func (c *Client) getDelegationV5(
+	ctx context.Context,
+	rewardAddress string,
+) (Delegation, error) {
+	key, err := rewardAccountKey(rewardAddress)
+	if err != nil {
+		return Delegation{}, err
+	}
+
+	var (
+		payload = makePayloadV5(
+			"Query",
+			Map{"query": Map{"delegationsAndRewards": []string{key}}},
+		)
+		content map[string]struct {
+			Delegate string   `json:"delegate"`
+			Rewards  *num.Int `json:"rewards"`
+		}
+	)
+	if err := c.queryResult(ctx, payload, &content); err != nil {
+		return Delegation{}, fmt.Errorf(
+			"failed to query delegations and rewards: %w",
+			err,
+		)
+	}
+
+	summary, ok := content[key]
+	if !ok {
+		return Delegation{
+			Rewards: num.Int64(0),
+		}, fmt.Errorf(
+			"reward account not found for reward address vfk: %s",
+			key,
+		)
+	}
+
+	delegation := Delegation{
+		PoolID:  summary.Delegate,
+		Rewards: num.Int64(0),
+	}
+	if summary.Rewards != nil {
+		delegation.Rewards = *summary.Rewards
+	}
+	return delegation, nil
+}
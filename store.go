@@ -16,21 +16,67 @@ package ogmigo
 
 import (
 	"context"
+	"fmt"
 	"strconv"
 
 	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync"
+	"github.com/buger/jsonparser"
 )
 
 // Store allows points to be saved and retrieved to allow graceful recovery
 // after shutdown
 type Store interface {
-	// Save the point; save will be called multiple times and should only
-	// keep track of the most recent points
+	// Save the point; save will be called multiple times and should keep
+	// track of the most recent points along with a history of older points,
+	// spaced further apart the older they are, so a rollback deeper than the
+	// most recent points still leaves a point to intersect with
 	Save(ctx context.Context, point chainsync.Point) error
 	// Load saved points
 	Load(ctx context.Context) (chainsync.Points, error)
 }
 
+// RollbackStore is a Store that is told of each rollback ChainSync delivers,
+// so that it may prune the points the rollback invalidated
+type RollbackStore interface {
+	Store
+	// Rollback removes the saved points after point
+	Rollback(ctx context.Context, point chainsync.Point) error
+}
+
+// TransactionalStore is a Store that saves each point in the same
+// transaction as the writes made while delivering it, e.g. one badger or SQL
+// transaction.  ChainSync then checkpoints every message carrying a point
+// through Transact, rather than calling Save periodically, so that after a
+// restart each block is delivered exactly once.
+type TransactionalStore interface {
+	Store
+	// Transact begins a transaction, calls fn with a ctx from which the
+	// transaction can be retrieved, then saves point and commits.  Should fn
+	// fail, the transaction is rolled back and the error returned as is.
+	Transact(ctx context.Context, point chainsync.Point, fn func(ctx context.Context) error) error
+}
+
+// pruneRollback passes the point of a delivered rollback to store, if it is
+// a RollbackStore.  Only rollbacks, told apart by their direction, are
+// decoded; messages from ogmios v5 have been converted by then.
+func pruneRollback(ctx context.Context, store Store, msg *syncMessage) error {
+	rs, ok := store.(RollbackStore)
+	if !ok {
+		return nil
+	}
+	if direction, _ := jsonparser.GetString(msg.data, "result", "direction"); direction != chainsync.RollBackwardString {
+		return nil
+	}
+	nbr, ok := msg.nextBlock()
+	if !ok || nbr.Direction != chainsync.RollBackwardString || nbr.Point == nil {
+		return nil
+	}
+	if err := rs.Rollback(ctx, *nbr.Point); err != nil {
+		return fmt.Errorf("failed to prune points after %v: %w", nbr.Point, err)
+	}
+	return nil
+}
+
 type loggingStore struct {
 	logger Logger
 }
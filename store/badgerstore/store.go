@@ -18,20 +18,30 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math/bits"
 	"sort"
-	"strconv"
 	"strings"
-	"sync/atomic"
 
 	"github.com/dgraph-io/badger/v3"
 
 	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync"
 )
 
+const (
+	// recentPoints is the number of most recent points always kept
+	recentPoints = 10
+	// bucketSlots is the span, in slots, of the first bucket of older points;
+	// each further bucket spans twice the slots of the one before
+	bucketSlots = 2160
+)
+
+// Store saves points to badger, keyed by slot.  Beyond the most recent
+// points, Store keeps only the oldest point in each bucket of exponentially
+// increasing span behind the newest, so a few dozen points reach back across
+// the whole chain.
 type Store struct {
-	db      *badger.DB
-	counter int64
-	prefix  []byte
+	db     *badger.DB
+	prefix []byte
 }
 
 func New(db *badger.DB, prefix string) *Store {
@@ -41,20 +51,43 @@ func New(db *badger.DB, prefix string) *Store {
 	}
 }
 
-// Save the point; save will be called multiple times and should only
-// keep track of the most recent points
+// storedPoint is the key and slot of a saved point
+type storedPoint struct {
+	key  []byte
+	slot uint64
+}
+
+// Save the point, replacing any saved at the same slot, and prune the
+// points no longer worth keeping
 func (s *Store) Save(_ context.Context, point chainsync.Point) error {
-	data, err := json.Marshal(point)
-	if err != nil {
+	tx := s.db.NewTransaction(true)
+	defer tx.Discard()
+
+	if err := s.save(tx, point); err != nil {
 		return fmt.Errorf("failed to save point: %w", err)
 	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to save point: commit failed: %w", err)
+	}
+
+	return s.db.Sync()
+}
 
-	v := atomic.AddInt64(&s.counter, 1) % 10
-	key := append(s.prefix, []byte(strconv.FormatInt(v, 10))...)
+type txnKey struct{}
 
+// Transact calls fn with a ctx carrying a badger transaction, see Txn, then
+// saves point in the same transaction and commits it.  Should fn fail, the
+// transaction is discarded.  Writes made by fn count towards badger's
+// transaction size limit.
+func (s *Store) Transact(ctx context.Context, point chainsync.Point, fn func(ctx context.Context) error) error {
 	tx := s.db.NewTransaction(true)
-	if err := tx.Set(key, data); err != nil {
-		return fmt.Errorf("failed to save point: set failed: %w", err)
+	defer tx.Discard()
+
+	if err := fn(context.WithValue(ctx, txnKey{}, tx)); err != nil {
+		return err
+	}
+	if err := s.save(tx, point); err != nil {
+		return fmt.Errorf("failed to save point: %w", err)
 	}
 	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("failed to save point: commit failed: %w", err)
@@ -63,6 +96,37 @@ func (s *Store) Save(_ context.Context, point chainsync.Point) error {
 	return s.db.Sync()
 }
 
+// Txn returns the transaction of a ctx passed to fn by Transact
+func Txn(ctx context.Context) (*badger.Txn, bool) {
+	tx, ok := ctx.Value(txnKey{}).(*badger.Txn)
+	return tx, ok
+}
+
+// Rollback removes the saved points after point
+func (s *Store) Rollback(_ context.Context, point chainsync.Point) error {
+	tx := s.db.NewTransaction(true)
+	defer tx.Discard()
+
+	saved, err := s.stored(tx)
+	if err != nil {
+		return fmt.Errorf("failed to roll back points: %w", err)
+	}
+	_, notOrigin := point.PointStruct()
+	for _, p := range saved {
+		if notOrigin && p.slot <= slotOf(point) {
+			continue
+		}
+		if err := tx.Delete(p.key); err != nil {
+			return fmt.Errorf("failed to roll back points: delete failed: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to roll back points: commit failed: %w", err)
+	}
+
+	return s.db.Sync()
+}
+
 // Load saved points
 func (s *Store) Load(context.Context) (chainsync.Points, error) {
 	tx := s.db.NewTransaction(false)
@@ -85,3 +149,83 @@ func (s *Store) Load(context.Context) (chainsync.Points, error) {
 
 	return pp, nil
 }
+
+// save sets the point within tx and prunes the points no longer worth
+// keeping
+func (s *Store) save(tx *badger.Txn, point chainsync.Point) error {
+	data, err := json.Marshal(point)
+	if err != nil {
+		return err
+	}
+	if err := tx.Set(s.key(slotOf(point)), data); err != nil {
+		return fmt.Errorf("set failed: %w", err)
+	}
+
+	saved, err := s.stored(tx)
+	if err != nil {
+		return err
+	}
+	for _, p := range prune(saved) {
+		if err := tx.Delete(p.key); err != nil {
+			return fmt.Errorf("delete failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// key returns the key of the point at slot; zero padding orders keys by slot
+func (s *Store) key(slot uint64) []byte {
+	key := append([]byte{}, s.prefix...)
+	return append(key, fmt.Sprintf("%020d", slot)...)
+}
+
+// stored returns the saved points, newest first.  Slots are read from the
+// values as points saved by earlier versions are keyed by a counter.
+func (s *Store) stored(tx *badger.Txn) ([]storedPoint, error) {
+	iter := tx.NewIterator(badger.DefaultIteratorOptions)
+	defer iter.Close()
+
+	var saved []storedPoint
+	for iter.Seek(s.prefix); iter.ValidForPrefix(s.prefix); iter.Next() {
+		var p chainsync.Point
+		unmarshal := func(val []byte) error { return json.Unmarshal(val, &p) }
+
+		item := iter.Item()
+		if err := item.Value(unmarshal); err != nil {
+			return nil, fmt.Errorf("failed to load points: %w", err)
+		}
+		saved = append(saved, storedPoint{key: item.KeyCopy(nil), slot: slotOf(p)})
+	}
+
+	sort.SliceStable(saved, func(i, j int) bool { return saved[i].slot > saved[j].slot })
+	return saved, nil
+}
+
+// prune returns the points, sorted newest first, that are no longer worth
+// keeping: beyond the recentPoints most recent, all but the oldest point in
+// each bucket
+func prune(saved []storedPoint) []storedPoint {
+	if len(saved) <= recentPoints {
+		return nil
+	}
+
+	newest := saved[0].slot
+	bucket := func(p storedPoint) int {
+		return bits.Len64((newest - p.slot) / bucketSlots)
+	}
+
+	var pruned []storedPoint
+	for i := recentPoints; i < len(saved)-1; i++ {
+		if bucket(saved[i]) == bucket(saved[i+1]) {
+			pruned = append(pruned, saved[i])
+		}
+	}
+	return pruned
+}
+
+func slotOf(point chainsync.Point) uint64 {
+	if ps, ok := point.PointStruct(); ok {
+		return ps.Slot
+	}
+	return 0
+}
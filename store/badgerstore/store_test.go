@@ -16,6 +16,7 @@ package badgerstore
 
 import (
 	"context"
+	"errors"
 	"reflect"
 	"testing"
 
@@ -65,3 +66,130 @@ func TestStore_Load(t *testing.T) {
 		t.Fatalf("got %#v; want %#v", got, want)
 	}
 }
+
+func TestStore_Rollback(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions(t.TempDir()).WithLogger(nil))
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	defer db.Close()
+
+	var (
+		ctx   = context.Background()
+		store = New(db, "points")
+	)
+	for slot := uint64(10); slot <= 50; slot += 10 {
+		if err := store.Save(ctx, chainsync.PointStruct{Slot: slot}.Point()); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+	}
+
+	if err := store.Rollback(ctx, chainsync.PointStruct{Slot: 30}.Point()); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	points, err := store.Load(ctx)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	want := chainsync.Points{
+		chainsync.PointStruct{Slot: 30}.Point(),
+		chainsync.PointStruct{Slot: 20}.Point(),
+		chainsync.PointStruct{Slot: 10}.Point(),
+	}
+	if got := points; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %#v; want %#v", got, want)
+	}
+
+	if err := store.Rollback(ctx, chainsync.Origin); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if points, err = store.Load(ctx); err != nil || len(points) != 0 {
+		t.Fatalf("got %v, %v; want no points", points, err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	var saved []storedPoint
+	for i := uint64(0); i < 40; i++ {
+		saved = append(saved, storedPoint{slot: 100_000 - i*1_000})
+	}
+
+	pruned := map[uint64]bool{}
+	for _, p := range prune(saved) {
+		pruned[p.slot] = true
+	}
+	var kept []uint64
+	for _, p := range saved {
+		if !pruned[p.slot] {
+			kept = append(kept, p.slot)
+		}
+	}
+
+	// the recent points, then the oldest of each bucket
+	want := []uint64{
+		100_000, 99_000, 98_000, 97_000, 96_000, 95_000, 94_000, 93_000, 92_000, 91_000,
+		83_000, 66_000, 61_000,
+	}
+	if !reflect.DeepEqual(kept, want) {
+		t.Fatalf("got %v; want %v", kept, want)
+	}
+}
+
+func TestStore_Transact(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions(t.TempDir()).WithLogger(nil))
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	defer db.Close()
+
+	var (
+		ctx   = context.Background()
+		store = New(db, "points")
+		a     = chainsync.PointStruct{Slot: 10}
+		b     = chainsync.PointStruct{Slot: 20}
+		boom  = errors.New("boom")
+	)
+	write := func(value string, err error) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			tx, ok := Txn(ctx)
+			if !ok {
+				t.Fatalf("got no transaction; want one")
+			}
+			if err := tx.Set([]byte("state"), []byte(value)); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			return err
+		}
+	}
+
+	if err := store.Transact(ctx, a.Point(), write("a", nil)); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if err := store.Transact(ctx, b.Point(), write("b", boom)); !errors.Is(err, boom) {
+		t.Fatalf("got %v; want %v", err, boom)
+	}
+
+	// the failed transaction saved neither its write nor its point
+	points, err := store.Load(ctx)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if want := (chainsync.Points{a.Point()}); !reflect.DeepEqual(points, want) {
+		t.Fatalf("got %#v; want %#v", points, want)
+	}
+	err = db.View(func(tx *badger.Txn) error {
+		item, err := tx.Get([]byte("state"))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			if got, want := string(val), "a"; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+}
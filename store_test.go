@@ -2,8 +2,15 @@ package ogmigo
 
 import (
 	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/SundaeSwap-finance/ogmigo/v6/ogmiostest"
 	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync"
 )
 
@@ -27,3 +34,230 @@ func TestNewLoggingStore(t *testing.T) {
 		t.Fatalf("got %v; want %v", got, want)
 	}
 }
+
+// rollbackStore records the rollbacks it is told of
+type rollbackStore struct {
+	nopStore
+	mutex     sync.Mutex
+	rollbacks []string
+}
+
+func (r *rollbackStore) Rollback(_ context.Context, point chainsync.Point) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.rollbacks = append(r.rollbacks, point.String())
+	return nil
+}
+
+func TestClient_ChainSyncRollbackStore(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	server := ogmiostest.NewServer()
+	defer server.Close()
+	for height := uint64(1); height <= 5; height++ {
+		server.RollForward(testBlock(height, strconv.FormatUint(height, 10)))
+	}
+	server.RollBackward(testBlock(3, "3").PointStruct().Point())
+	server.RollForward(testBlock(4, "4b"))
+
+	client := New(WithEndpoint(server.URL), WithLogger(NopLogger))
+	defer client.Close()
+
+	handler := newHubRecorder(6)
+	store := &rollbackStore{}
+	closer, err := client.ChainSyncWithHandler(ctx, handler, WithStore(store))
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	defer closer.Close()
+
+	select {
+	case <-ctx.Done():
+		t.Fatalf("got %v; want blocks", ctx.Err())
+	case <-handler.done:
+	}
+	_ = closer.Close()
+	<-closer.Done()
+
+	// ogmios first rolls back to the intersection
+	want := []string{chainsync.Origin.String(), testBlock(3, "3").PointStruct().Point().String()}
+	if got := store.rollbacks; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
+
+func Test_pruneRollback(t *testing.T) {
+	tests := map[string]struct {
+		data string
+		want []string
+	}{
+		"forward": {
+			data: `{"jsonrpc":"2.0","method":"nextBlock","result":{"direction":"forward","block":{"type":"praos","era":"babbage","id":"a","height":1,"slot":10}}}`,
+		},
+		"backward": {
+			data: `{"jsonrpc":"2.0","method":"nextBlock","result":{"direction":"backward","point":{"slot":10,"id":"a"}}}`,
+			want: []string{chainsync.PointStruct{Slot: 10, ID: "a"}.Point().String()},
+		},
+		"find intersection": {
+			data: `{"jsonrpc":"2.0","method":"findIntersection","result":{"intersection":"origin"}}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var (
+				store  = &rollbackStore{}
+				before = atomic.LoadInt64(&decodes)
+			)
+			if err := pruneRollback(context.Background(), store, &syncMessage{data: []byte(tc.data)}); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got := store.rollbacks; !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got %v; want %v", got, tc.want)
+			}
+			if decoded := atomic.LoadInt64(&decodes) - before; tc.want == nil && decoded != 0 {
+				t.Fatalf("got %v; want no messages decoded", decoded)
+			}
+		})
+	}
+}
+
+// txStore commits the points transacted, less those whose fn failed
+type txStore struct {
+	mutex     sync.Mutex
+	saved     []string
+	committed []string
+}
+
+func (s *txStore) Save(_ context.Context, point chainsync.Point) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.saved = append(s.saved, point.String())
+	return nil
+}
+
+func (s *txStore) Load(context.Context) (chainsync.Points, error) {
+	return nil, nil
+}
+
+func (s *txStore) Transact(ctx context.Context, point chainsync.Point, fn func(ctx context.Context) error) error {
+	if err := fn(ctx); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.committed = append(s.committed, point.String())
+	return nil
+}
+
+// failingHandler fails on the block at height fail
+type failingHandler struct {
+	rollbackRecorder
+	fail uint64
+}
+
+func (h failingHandler) OnRollForward(ctx context.Context, block *chainsync.Block, tip chainsync.PointStruct) error {
+	if block.Height == h.fail {
+		return errors.New("boom")
+	}
+	return h.rollbackRecorder.OnRollForward(ctx, block, tip)
+}
+
+func TestClient_ChainSyncTransactionalStore(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	server := ogmiostest.NewServer()
+	defer server.Close()
+	for height := uint64(1); height <= 5; height++ {
+		server.RollForward(testBlock(height, strconv.FormatUint(height, 10)))
+	}
+
+	client := New(WithEndpoint(server.URL), WithLogger(NopLogger))
+	defer client.Close()
+
+	handler := failingHandler{
+		rollbackRecorder: rollbackRecorder{&handlerRecorder{done: make(chan struct{})}},
+		fail:             4,
+	}
+	store := &txStore{}
+	closer, err := client.ChainSyncWithHandler(ctx, handler, WithStore(store))
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	defer closer.Close()
+
+	select {
+	case <-ctx.Done():
+		t.Fatalf("got %v; want callback failure", ctx.Err())
+	case <-closer.Done():
+	}
+	if err := closer.Close(); err == nil {
+		t.Fatalf("got nil; want callback failure")
+	}
+
+	// every delivered message is committed, and nothing else saved
+	want := []string{chainsync.Origin.String()}
+	for height := uint64(1); height <= 3; height++ {
+		want = append(want, testBlock(height, strconv.FormatUint(height, 10)).PointStruct().Point().String())
+	}
+	if got := store.committed; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if len(store.saved) > 0 {
+		t.Fatalf("got %v; want no points saved", store.saved)
+	}
+}
+
+func TestClient_ChainSyncRawNotDecoded(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	const blocks = 10
+	client := New(
+		WithTransport(NewMemoryTransport(memoryOgmios(blocks))),
+		WithLogger(NopLogger),
+		WithInterval(1000),
+	)
+	defer client.Close()
+
+	tests := map[string]Store{
+		"store":          mockStore{},
+		"rollback store": &rollbackStore{},
+	}
+
+	for name, store := range tests {
+		t.Run(name, func(t *testing.T) {
+			var (
+				before   = atomic.LoadInt64(&decodes)
+				received int
+				decoded  int64
+				done     = make(chan struct{})
+			)
+			callback := func(ctx context.Context, data []byte) error {
+				// messages are processed in order, so every earlier message
+				// has been saved, pruned and observed by now
+				if received++; received == blocks+1 {
+					decoded = atomic.LoadInt64(&decodes) - before
+					close(done)
+				}
+				return nil
+			}
+			closer, err := client.ChainSync(ctx, callback, WithStore(store))
+			if err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			defer closer.Close()
+
+			select {
+			case <-ctx.Done():
+				t.Fatalf("got %v; want %v messages", ctx.Err(), blocks+1)
+			case <-done:
+			}
+			if decoded != 0 {
+				t.Fatalf("got %v; want no messages decoded", decoded)
+			}
+		})
+	}
+}
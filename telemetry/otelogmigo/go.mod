@@ -0,0 +1,28 @@
+module github.com/SundaeSwap-finance/ogmigo/telemetry/otelogmigo
+
+go 1.20
+
+require (
+	github.com/SundaeSwap-finance/ogmigo/v6 v6.0.0-00010101000000-000000000000
+	github.com/buger/jsonparser v1.1.1
+	github.com/gorilla/websocket v1.5.0
+	go.opentelemetry.io/otel v1.24.0
+	go.opentelemetry.io/otel/metric v1.24.0
+	go.opentelemetry.io/otel/sdk v1.24.0
+	go.opentelemetry.io/otel/sdk/metric v1.24.0
+	go.opentelemetry.io/otel/trace v1.24.0
+)
+
+require (
+	github.com/aws/aws-sdk-go v1.44.197 // indirect
+	github.com/btcsuite/btcutil v1.0.2 // indirect
+	github.com/fxamacker/cbor/v2 v2.4.0 // indirect
+	github.com/go-logr/logr v1.4.1 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/jmespath/go-jmespath v0.4.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+	golang.org/x/sync v0.1.0 // indirect
+	golang.org/x/sys v0.18.0 // indirect
+)
+
+replace github.com/SundaeSwap-finance/ogmigo/v6 => ../..
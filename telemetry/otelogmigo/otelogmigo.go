@@ -0,0 +1,204 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package otelogmigo instruments an ogmigo.Client with OpenTelemetry.  Each
+// one-shot request e.g. state queries, SubmitTx and EvaluateTx, is traced as
+// a span, while ChainSync and MonitorMempool activity is reported as metrics.
+//
+//	instrumentation, err := otelogmigo.New()
+//	if err != nil { ... }
+//	client := ogmigo.New(instrumentation.Option())
+package otelogmigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6"
+	"github.com/buger/jsonparser"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/SundaeSwap-finance/ogmigo/telemetry/otelogmigo"
+
+type options struct {
+	meterProvider  metric.MeterProvider
+	tracerProvider trace.TracerProvider
+}
+
+// Option configures the instrumentation
+type Option func(*options)
+
+// WithMeterProvider specifies the MeterProvider; defaults to the global provider
+func WithMeterProvider(provider metric.MeterProvider) Option {
+	return func(opts *options) {
+		opts.meterProvider = provider
+	}
+}
+
+// WithTracerProvider specifies the TracerProvider; defaults to the global provider
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(opts *options) {
+		opts.tracerProvider = provider
+	}
+}
+
+// Instrumentation records spans and metrics for an ogmigo.Client
+type Instrumentation struct {
+	tracer trace.Tracer
+
+	blocks      metric.Int64Counter
+	rollbacks   metric.Int64Counter
+	callbacks   metric.Float64Histogram
+	pipeline    metric.Int64Histogram
+	reconnects  metric.Int64Counter
+	checkpoints metric.Int64Counter
+}
+
+// New returns Instrumentation using the provided options
+func New(opts ...Option) (*Instrumentation, error) {
+	options := options{
+		meterProvider:  otel.GetMeterProvider(),
+		tracerProvider: otel.GetTracerProvider(),
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	meter := options.meterProvider.Meter(instrumentationName)
+	i := &Instrumentation{
+		tracer: options.tracerProvider.Tracer(instrumentationName),
+	}
+
+	var err error
+	if i.blocks, err = meter.Int64Counter(
+		"ogmigo.chainsync.blocks",
+		metric.WithDescription("Blocks received by ChainSync"),
+		metric.WithUnit("{block}"),
+	); err != nil {
+		return nil, fmt.Errorf("failed to create blocks counter: %w", err)
+	}
+	if i.rollbacks, err = meter.Int64Counter(
+		"ogmigo.chainsync.rollbacks",
+		metric.WithDescription("Rollbacks received by ChainSync"),
+		metric.WithUnit("{rollback}"),
+	); err != nil {
+		return nil, fmt.Errorf("failed to create rollbacks counter: %w", err)
+	}
+	if i.callbacks, err = meter.Float64Histogram(
+		"ogmigo.callback.duration",
+		metric.WithDescription("Time spent in the ChainSync and MonitorMempool callbacks"),
+		metric.WithUnit("s"),
+	); err != nil {
+		return nil, fmt.Errorf("failed to create callback histogram: %w", err)
+	}
+	if i.pipeline, err = meter.Int64Histogram(
+		"ogmigo.chainsync.pipeline",
+		metric.WithDescription("nextBlock requests in flight when each response is received"),
+		metric.WithUnit("{request}"),
+	); err != nil {
+		return nil, fmt.Errorf("failed to create pipeline histogram: %w", err)
+	}
+	if i.reconnects, err = meter.Int64Counter(
+		"ogmigo.reconnects",
+		metric.WithDescription("Reconnect attempts by ChainSync and MonitorMempool"),
+		metric.WithUnit("{attempt}"),
+	); err != nil {
+		return nil, fmt.Errorf("failed to create reconnects counter: %w", err)
+	}
+	if i.checkpoints, err = meter.Int64Counter(
+		"ogmigo.chainsync.checkpoints",
+		metric.WithDescription("Points saved to the ChainSync store"),
+		metric.WithUnit("{checkpoint}"),
+	); err != nil {
+		return nil, fmt.Errorf("failed to create checkpoints counter: %w", err)
+	}
+
+	return i, nil
+}
+
+// Option installs the instrumentation on an ogmigo.Client
+func (i *Instrumentation) Option() ogmigo.Option {
+	return func(opts *ogmigo.Options) {
+		ogmigo.WithQueryInterceptors(i.InterceptQuery)(opts)
+		ogmigo.WithObservers(i)(opts)
+	}
+}
+
+// InterceptQuery traces each one-shot request; it implements
+// ogmigo.QueryInterceptor
+func (i *Instrumentation) InterceptQuery(
+	ctx context.Context,
+	req *ogmigo.Request,
+	invoke ogmigo.Invoker,
+) ([]byte, error) {
+	ctx, span := i.tracer.Start(ctx, req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "jsonrpc"),
+			attribute.String("rpc.method", req.Method),
+			attribute.Int64("rpc.jsonrpc.request_id", int64(req.ID)),
+		),
+	)
+	defer span.End()
+
+	raw, err := invoke(ctx, req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	// ogmios errors are returned in the response body
+	if code, err := jsonparser.GetInt(raw, "error", "code"); err == nil {
+		message, _ := jsonparser.GetString(raw, "error", "message")
+		span.SetAttributes(
+			attribute.Int64("rpc.jsonrpc.error_code", code),
+			attribute.String("rpc.jsonrpc.error_message", message),
+		)
+		span.SetStatus(codes.Error, message)
+	}
+	return raw, nil
+}
+
+// Observe records ChainSync and MonitorMempool metrics; it implements
+// ogmigo.Observer
+func (i *Instrumentation) Observe(ctx context.Context, event ogmigo.Event) {
+	switch e := event.(type) {
+	case ogmigo.RollForwardEvent:
+		i.blocks.Add(ctx, 1)
+	case ogmigo.RollBackwardEvent:
+		i.rollbacks.Add(ctx, 1)
+	case ogmigo.CallbackEvent:
+		i.callbacks.Record(ctx, e.Duration.Seconds(), metric.WithAttributes(
+			attribute.String("protocol", e.Protocol),
+			attribute.Bool("error", e.Err != nil && !errors.Is(e.Err, context.Canceled)),
+		))
+	case ogmigo.PipelineEvent:
+		i.pipeline.Record(ctx, int64(e.InFlight))
+	case ogmigo.ReconnectEvent:
+		i.reconnects.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("protocol", e.Protocol),
+		))
+	case ogmigo.CheckpointEvent:
+		i.checkpoints.Add(ctx, 1, metric.WithAttributes(
+			attribute.Bool("error", e.Err != nil),
+		))
+	}
+}
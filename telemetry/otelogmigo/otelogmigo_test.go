@@ -0,0 +1,197 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otelogmigo
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6"
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// fakeOgmios serves the tip query, rejects every submission and streams two
+// blocks followed by a rollback
+func fakeOgmios(ctx context.Context, conn ogmigo.Conn) {
+	var n int
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var request struct {
+			Method string
+			ID     json.RawMessage
+		}
+		if err := json.Unmarshal(data, &request); err != nil {
+			return
+		}
+
+		tip := ogmigo.Map{"slot": 20, "id": "tip", "height": 2}
+		response := ogmigo.Map{"jsonrpc": "2.0", "method": request.Method, "id": request.ID}
+		switch request.Method {
+		case "queryLedgerState/tip":
+			response["result"] = tip
+		case "submitTransaction":
+			response["error"] = ogmigo.Map{"code": 3117, "message": "unknown inputs"}
+		case "findIntersection":
+			response["result"] = ogmigo.Map{"intersection": "origin", "tip": tip}
+		case "nextBlock":
+			n++
+			switch {
+			case n <= 2:
+				response["result"] = ogmigo.Map{
+					"direction": "forward",
+					"tip":       tip,
+					"block":     ogmigo.Map{"type": "praos", "era": "babbage", "id": "block", "height": n, "slot": n * 10},
+				}
+			case n == 3:
+				response["result"] = ogmigo.Map{
+					"direction": "backward",
+					"tip":       tip,
+					"point":     ogmigo.Map{"slot": 10, "id": "block"},
+				}
+			default:
+				continue
+			}
+		}
+
+		data, _ = json.Marshal(response)
+		if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			return
+		}
+	}
+}
+
+func TestInstrumentation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var (
+		spans          = tracetest.NewSpanRecorder()
+		tracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+		reader         = sdkmetric.NewManualReader()
+		meterProvider  = sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	)
+
+	instrumentation, err := New(
+		WithTracerProvider(tracerProvider),
+		WithMeterProvider(meterProvider),
+	)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	client := ogmigo.New(
+		ogmigo.WithTransport(ogmigo.NewMemoryTransport(fakeOgmios)),
+		ogmigo.WithLogger(ogmigo.NopLogger),
+		instrumentation.Option(),
+	)
+	defer client.Close()
+
+	t.Run("spans", func(t *testing.T) {
+		if _, err := client.ChainTip(ctx); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if _, err := client.SubmitTx(ctx, "deadbeef"); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+
+		ended := spans.Ended()
+		if got, want := len(ended), 2; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := ended[0].Name(), "queryLedgerState/tip"; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := ended[0].Status().Code, codes.Unset; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := ended[1].Name(), "submitTransaction"; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := ended[1].Status().Code, codes.Error; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("metrics", func(t *testing.T) {
+		done := make(chan struct{})
+		var received int
+		callback := func(context.Context, []byte) error {
+			if received++; received == 4 { // intersection, 2 blocks, rollback
+				close(done)
+			}
+			return nil
+		}
+		closer, err := client.ChainSync(ctx, callback)
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		select {
+		case <-done:
+		case <-ctx.Done():
+			t.Fatalf("got timeout; want chainsync messages")
+		}
+		_ = closer.Close()
+
+		var rm metricdata.ResourceMetrics
+		if err := reader.Collect(ctx, &rm); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+
+		sums := map[string]int64{}
+		counts := map[string]uint64{}
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				switch data := m.Data.(type) {
+				case metricdata.Sum[int64]:
+					for _, dp := range data.DataPoints {
+						sums[m.Name] += dp.Value
+					}
+				case metricdata.Histogram[float64]:
+					for _, dp := range data.DataPoints {
+						counts[m.Name] += dp.Count
+					}
+				case metricdata.Histogram[int64]:
+					for _, dp := range data.DataPoints {
+						counts[m.Name] += dp.Count
+					}
+				}
+			}
+		}
+
+		if got, want := sums["ogmigo.chainsync.blocks"], int64(2); got != want {
+			t.Fatalf("got %v; want %v blocks", got, want)
+		}
+		if got, want := sums["ogmigo.chainsync.rollbacks"], int64(1); got != want {
+			t.Fatalf("got %v; want %v rollbacks", got, want)
+		}
+		if got, want := counts["ogmigo.chainsync.pipeline"], uint64(3); got != want {
+			t.Fatalf("got %v; want %v pipeline observations", got, want)
+		}
+		if got := counts["ogmigo.callback.duration"]; got < 3 {
+			t.Fatalf("got %v; want at least 3 callback observations", got)
+		}
+	})
+}
@@ -0,0 +1,29 @@
+module github.com/SundaeSwap-finance/ogmigo/telemetry/promogmigo
+
+go 1.20
+
+require (
+	github.com/SundaeSwap-finance/ogmigo/v6 v6.0.0-00010101000000-000000000000
+	github.com/prometheus/client_golang v1.19.0
+)
+
+require (
+	github.com/aws/aws-sdk-go v1.44.197 // indirect
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/btcsuite/btcutil v1.0.2 // indirect
+	github.com/buger/jsonparser v1.1.1 // indirect
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/fxamacker/cbor/v2 v2.4.0 // indirect
+	github.com/gorilla/websocket v1.5.0 // indirect
+	github.com/jmespath/go-jmespath v0.4.0 // indirect
+	github.com/prometheus/client_model v0.5.0 // indirect
+	github.com/prometheus/common v0.48.0 // indirect
+	github.com/prometheus/procfs v0.12.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+	golang.org/x/sync v0.3.0 // indirect
+	golang.org/x/sys v0.16.0 // indirect
+	google.golang.org/protobuf v1.32.0 // indirect
+)
+
+replace github.com/SundaeSwap-finance/ogmigo/v6 => ../..
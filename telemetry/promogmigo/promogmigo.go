@@ -0,0 +1,213 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package promogmigo exposes ChainSync and MonitorMempool health as
+// prometheus metrics.  The Collector observes the events raised by the
+// ogmigo.Client, so messages are not decoded a second time.
+//
+//	collector := promogmigo.New()
+//	prometheus.MustRegister(collector)
+//	client := ogmigo.New(ogmigo.WithObservers(collector))
+package promogmigo
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	namespace = "ogmigo"
+
+	// rateWindow is the period over which blocks per second is measured
+	rateWindow = 10 * time.Second
+)
+
+// Collector is a prometheus.Collector tracking how far ChainSync is behind
+// the node tip along with the size and duration of mempool snapshots.  It
+// implements ogmigo.Observer.
+type Collector struct {
+	slot           prometheus.Gauge
+	height         prometheus.Gauge
+	tipSlot        prometheus.Gauge
+	slotLag        prometheus.Gauge
+	blocks         prometheus.Counter
+	blocksPerSec   prometheus.Gauge
+	rollbackDepth  prometheus.Histogram
+	mempoolSize    prometheus.Gauge
+	mempoolLatency prometheus.Histogram
+
+	mutex        sync.Mutex
+	tip          uint64 // most recent tip slot
+	windowStart  time.Time
+	windowBlocks int
+	now          func() time.Time
+}
+
+// New returns a Collector; register it with prometheus and pass it to the
+// client via ogmigo.WithObservers
+func New() *Collector {
+	return &Collector{
+		slot: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "chainsync",
+			Name:      "slot",
+			Help:      "Slot of the last block processed by the ChainSync callback.",
+		}),
+		height: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "chainsync",
+			Name:      "height",
+			Help:      "Height of the last block processed by the ChainSync callback.",
+		}),
+		tipSlot: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "chainsync",
+			Name:      "tip_slot",
+			Help:      "Slot of the node tip as reported with each block.",
+		}),
+		slotLag: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "chainsync",
+			Name:      "slot_lag",
+			Help:      "Slots between the node tip and the last processed block.",
+		}),
+		blocks: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "chainsync",
+			Name:      "blocks_total",
+			Help:      "Blocks received by ChainSync.",
+		}),
+		blocksPerSec: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "chainsync",
+			Name:      "blocks_per_second",
+			Help:      "Blocks received per second, measured over the last 10 seconds.",
+		}),
+		rollbackDepth: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "chainsync",
+			Name:      "rollback_depth_slots",
+			Help:      "Number of slots rolled back by each rollback.",
+			Buckets:   prometheus.ExponentialBuckets(1, 4, 8),
+		}),
+		mempoolSize: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "mempool",
+			Name:      "snapshot_transactions",
+			Help:      "Transactions in the most recent mempool snapshot.",
+		}),
+		mempoolLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "mempool",
+			Name:      "snapshot_duration_seconds",
+			Help:      "Time taken to receive each mempool snapshot.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+		now: time.Now,
+	}
+}
+
+func (c *Collector) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		c.slot,
+		c.height,
+		c.tipSlot,
+		c.slotLag,
+		c.blocks,
+		c.blocksPerSec,
+		c.rollbackDepth,
+		c.mempoolSize,
+		c.mempoolLatency,
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, collector := range c.collectors() {
+		collector.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mutex.Lock()
+	c.updateRate(c.now())
+	c.mutex.Unlock()
+
+	for _, collector := range c.collectors() {
+		collector.Collect(ch)
+	}
+}
+
+// Observe implements ogmigo.Observer
+func (c *Collector) Observe(_ context.Context, event ogmigo.Event) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	switch e := event.(type) {
+	case ogmigo.RollForwardEvent:
+		c.blocks.Inc()
+		c.windowBlocks++
+		c.updateRate(c.now())
+		c.setTip(e.TipSlot)
+
+	case ogmigo.RollBackwardEvent:
+		c.rollbackDepth.Observe(float64(e.Depth))
+		c.setTip(e.TipSlot)
+
+	case ogmigo.DeliveredEvent:
+		// blocks are received ahead of delivery, so the newest tip is used
+		if c.tip == 0 {
+			c.setTip(e.TipSlot)
+		}
+		c.slot.Set(float64(e.Slot))
+		if e.Height > 0 {
+			c.height.Set(float64(e.Height))
+		}
+		var lag uint64
+		if c.tip > e.Slot {
+			lag = c.tip - e.Slot
+		}
+		c.slotLag.Set(float64(lag))
+
+	case ogmigo.MempoolSnapshotEvent:
+		c.mempoolSize.Set(float64(e.Transactions))
+		c.mempoolLatency.Observe(e.Duration.Seconds())
+	}
+}
+
+func (c *Collector) setTip(slot uint64) {
+	c.tip = slot
+	c.tipSlot.Set(float64(slot))
+}
+
+// updateRate recalculates blocks per second once the current window has
+// elapsed.  Must be called with the mutex held.
+func (c *Collector) updateRate(now time.Time) {
+	if c.windowStart.IsZero() {
+		c.windowStart = now
+		return
+	}
+	elapsed := now.Sub(c.windowStart)
+	if elapsed < rateWindow {
+		return
+	}
+	c.blocksPerSec.Set(float64(c.windowBlocks) / elapsed.Seconds())
+	c.windowStart = now
+	c.windowBlocks = 0
+}
@@ -0,0 +1,169 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promogmigo
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ogmiostest"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+
+	collector := New()
+	collector.now = func() time.Time { return now }
+
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(collector); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	events := []ogmigo.Event{
+		ogmigo.RollForwardEvent{Slot: 100, Height: 10, TipSlot: 160, TipHeight: 16},
+		ogmigo.DeliveredEvent{Slot: 100, Height: 10, TipSlot: 160, TipHeight: 16},
+		ogmigo.RollForwardEvent{Slot: 120, Height: 11, TipSlot: 160, TipHeight: 16},
+		ogmigo.DeliveredEvent{Slot: 120, Height: 11, TipSlot: 160, TipHeight: 16},
+		ogmigo.RollBackwardEvent{Slot: 100, Depth: 20, TipSlot: 170, TipHeight: 17},
+		ogmigo.DeliveredEvent{Slot: 100, TipSlot: 170, TipHeight: 17},
+		ogmigo.RollForwardEvent{Slot: 140, Height: 11, TipSlot: 170, TipHeight: 17},
+		ogmigo.MempoolSnapshotEvent{Slot: 170, Transactions: 3, Duration: 250 * time.Millisecond},
+	}
+	for _, event := range events {
+		collector.Observe(ctx, event)
+	}
+	now = now.Add(rateWindow)
+
+	// the final block has not been processed by the callback yet
+	want := `
+# HELP ogmigo_chainsync_blocks_per_second Blocks received per second, measured over the last 10 seconds.
+# TYPE ogmigo_chainsync_blocks_per_second gauge
+ogmigo_chainsync_blocks_per_second 0.3
+# HELP ogmigo_chainsync_blocks_total Blocks received by ChainSync.
+# TYPE ogmigo_chainsync_blocks_total counter
+ogmigo_chainsync_blocks_total 3
+# HELP ogmigo_chainsync_height Height of the last block processed by the ChainSync callback.
+# TYPE ogmigo_chainsync_height gauge
+ogmigo_chainsync_height 11
+# HELP ogmigo_chainsync_slot Slot of the last block processed by the ChainSync callback.
+# TYPE ogmigo_chainsync_slot gauge
+ogmigo_chainsync_slot 100
+# HELP ogmigo_chainsync_slot_lag Slots between the node tip and the last processed block.
+# TYPE ogmigo_chainsync_slot_lag gauge
+ogmigo_chainsync_slot_lag 70
+# HELP ogmigo_chainsync_tip_slot Slot of the node tip as reported with each block.
+# TYPE ogmigo_chainsync_tip_slot gauge
+ogmigo_chainsync_tip_slot 170
+# HELP ogmigo_mempool_snapshot_transactions Transactions in the most recent mempool snapshot.
+# TYPE ogmigo_mempool_snapshot_transactions gauge
+ogmigo_mempool_snapshot_transactions 3
+`
+	err := testutil.GatherAndCompare(registry, strings.NewReader(want),
+		"ogmigo_chainsync_blocks_per_second",
+		"ogmigo_chainsync_blocks_total",
+		"ogmigo_chainsync_height",
+		"ogmigo_chainsync_slot",
+		"ogmigo_chainsync_slot_lag",
+		"ogmigo_chainsync_tip_slot",
+		"ogmigo_mempool_snapshot_transactions",
+	)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	if got, want := testutil.CollectAndCount(collector, "ogmigo_chainsync_rollback_depth_slots"), 1; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := testutil.CollectAndCount(collector, "ogmigo_mempool_snapshot_duration_seconds"), 1; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
+
+func TestCollector_Confirmations(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	const (
+		n             = 10
+		confirmations = 3
+	)
+	server := ogmiostest.NewServer()
+	defer server.Close()
+	for height := uint64(1); height <= n; height++ {
+		server.RollForward(chainsync.Block{
+			Type:   "praos",
+			Era:    "babbage",
+			ID:     strconv.FormatUint(height, 10),
+			Height: height,
+			Slot:   height * 10,
+		})
+	}
+
+	collector := New()
+	client := ogmigo.New(
+		ogmigo.WithEndpoint(server.URL),
+		ogmigo.WithLogger(ogmigo.NopLogger),
+		ogmigo.WithObservers(collector),
+	)
+	defer client.Close()
+
+	// the gauges follow the blocks delivered, not the blocks received
+	delivered := make(chan uint64, n)
+	callback := func(_ context.Context, data []byte) error {
+		var response chainsync.ResponsePraos
+		if err := json.Unmarshal(data, &response); err != nil {
+			return err
+		}
+		if response.Method == chainsync.NextBlockMethod {
+			if result := response.MustNextBlockResult(); result.Block != nil {
+				delivered <- result.Block.Slot
+			}
+		}
+		return nil
+	}
+	closer, err := client.ChainSync(ctx, callback, ogmigo.WithConfirmations(confirmations))
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	defer closer.Close()
+
+	var last uint64
+	for last < (n-confirmations)*10 {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("got %v; want blocks", ctx.Err())
+		case last = <-delivered:
+		}
+	}
+	_ = closer.Close()
+	<-closer.Done()
+
+	if got, want := testutil.ToFloat64(collector.slot), float64(last); got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := testutil.ToFloat64(collector.slotLag), float64(n*10-last); got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
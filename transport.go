@@ -0,0 +1,304 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogmigo
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Conn is a message oriented connection to ogmios.  Message types follow the
+// websocket conventions e.g. websocket.TextMessage.  *websocket.Conn
+// satisfies Conn.
+type Conn interface {
+	ReadMessage() (messageType int, data []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	SetWriteDeadline(t time.Time) error
+	Close() error
+}
+
+// Transport opens connections to ogmios; queries, chain sync and mempool
+// monitoring all connect via the Transport
+type Transport interface {
+	Dial(ctx context.Context, endpoint string) (Conn, error)
+}
+
+type websocketTransport struct {
+	dialer *websocket.Dialer
+	header http.Header
+}
+
+// NewWebsocketTransport returns a Transport that connects using the provided
+// websocket dialer, sending header with each handshake.  Unless WithTransport
+// is used, the Client builds one from the dialer related options.
+func NewWebsocketTransport(
+	dialer *websocket.Dialer,
+	header http.Header,
+) Transport {
+	if dialer == nil {
+		dialer = websocket.DefaultDialer
+	}
+	return websocketTransport{
+		dialer: dialer,
+		header: header,
+	}
+}
+
+func (w websocketTransport) Dial(ctx context.Context, endpoint string) (Conn, error) {
+	endpoint, header, err := withCredentials(endpoint, w.header)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, _, err := w.dialer.DialContext(ctx, endpoint, header)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// withCredentials moves any user:pass embedded in the endpoint into a basic
+// auth header, as websocket urls may not contain credentials
+func withCredentials(endpoint string, header http.Header) (string, http.Header, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		// url errors echo the url, which may contain credentials
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			err = ue.Err
+		}
+		return "", nil, fmt.Errorf("invalid endpoint: %w", err)
+	}
+	if u.User == nil {
+		return endpoint, header, nil
+	}
+
+	header = header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	if header.Get("Authorization") == "" {
+		password, _ := u.User.Password()
+		credentials := u.User.Username() + ":" + password
+		header.Set(
+			"Authorization",
+			"Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)),
+		)
+	}
+	u.User = nil
+	return u.String(), header, nil
+}
+
+// redact removes any credentials from the endpoint so it is safe to log
+func redact(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "invalid endpoint"
+	}
+	if u.User == nil {
+		return endpoint
+	}
+	u.User = nil
+	return u.String()
+}
+
+// NewUnixTransport returns a Transport that speaks websocket over the unix
+// domain socket at path e.g. when ogmios runs as a sidecar.  The endpoint
+// is still used for the websocket handshake, but its host is ignored.
+func NewUnixTransport(path string) Transport {
+	dialer := *websocket.DefaultDialer
+	dialer.NetDialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", path)
+	}
+	return NewWebsocketTransport(&dialer, nil)
+}
+
+// MemoryHandler serves a single in-memory connection; the connection is
+// closed once the handler returns
+type MemoryHandler func(ctx context.Context, conn Conn)
+
+type memoryTransport struct {
+	handler MemoryHandler
+}
+
+// NewMemoryTransport returns a Transport that connects the client to handler
+// in-process, without any network.  Each Dial invokes handler in its own
+// goroutine with the server side of the connection.
+func NewMemoryTransport(handler MemoryHandler) Transport {
+	return memoryTransport{
+		handler: handler,
+	}
+}
+
+func (m memoryTransport) Dial(ctx context.Context, _ string) (Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	client, server := newMemoryPipe()
+	go func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			select {
+			case <-server.closed:
+			case <-server.peer.closed:
+			}
+			cancel()
+		}()
+		//nolint:errcheck
+		defer server.Close()
+
+		m.handler(ctx, server)
+	}()
+	return client, nil
+}
+
+type memoryMessage struct {
+	messageType int
+	data        []byte
+}
+
+// memoryConn is one end of an in-memory connection
+type memoryConn struct {
+	in     chan memoryMessage
+	out    chan memoryMessage
+	peer   *memoryConn
+	closed chan struct{}
+	once   sync.Once
+
+	mutex    sync.Mutex
+	deadline time.Time
+}
+
+func newMemoryPipe() (*memoryConn, *memoryConn) {
+	var (
+		ab = make(chan memoryMessage, 64)
+		ba = make(chan memoryMessage, 64)
+		a  = &memoryConn{in: ba, out: ab, closed: make(chan struct{})}
+		b  = &memoryConn{in: ab, out: ba, closed: make(chan struct{})}
+	)
+	a.peer, b.peer = b, a
+	return a, b
+}
+
+func (m *memoryConn) closedError(op string) error {
+	return &net.OpError{Op: op, Net: "memory", Err: net.ErrClosed}
+}
+
+func (m *memoryConn) ReadMessage() (int, []byte, error) {
+	select {
+	case <-m.closed:
+		return 0, nil, m.closedError("read")
+	default:
+	}
+
+	select {
+	case msg := <-m.in:
+		return msg.messageType, msg.data, nil
+	case <-m.closed:
+		return 0, nil, m.closedError("read")
+	case <-m.peer.closed:
+		// deliver anything written before the peer went away
+		select {
+		case msg := <-m.in:
+			return msg.messageType, msg.data, nil
+		default:
+			return 0, nil, io.EOF
+		}
+	}
+}
+
+func (m *memoryConn) WriteMessage(messageType int, data []byte) error {
+	m.mutex.Lock()
+	deadline := m.deadline
+	m.mutex.Unlock()
+
+	var expired <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	msg := memoryMessage{
+		messageType: messageType,
+		data:        append([]byte(nil), data...),
+	}
+	select {
+	case m.out <- msg:
+		return nil
+	case <-m.closed:
+		return m.closedError("write")
+	case <-m.peer.closed:
+		return io.ErrClosedPipe
+	case <-expired:
+		return fmt.Errorf("memory write: %w", context.DeadlineExceeded)
+	}
+}
+
+func (m *memoryConn) SetWriteDeadline(t time.Time) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.deadline = t
+	return nil
+}
+
+func (m *memoryConn) Close() error {
+	m.once.Do(func() { close(m.closed) })
+	return nil
+}
+
+// dial opens a new connection to the healthiest endpoint that accepts it
+func (c *Client) dial(ctx context.Context) (Conn, *endpoint, error) {
+	var err error
+	for _, e := range c.endpoints.order() {
+		var conn Conn
+		conn, err = c.dialEndpoint(ctx, e.url)
+		if err == nil {
+			c.endpoints.succeeded(e, 0)
+			return conn, e, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		c.endpoints.failed(e)
+	}
+	return nil, nil, err
+}
+
+// dialEndpoint opens a new connection to the endpoint via the Transport
+func (c *Client) dialEndpoint(ctx context.Context, endpoint string) (Conn, error) {
+	conn, err := c.options.transport.Dial(ctx, endpoint)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"failed to connect to ogmios, %v: %w",
+			redact(endpoint),
+			err,
+		)
+	}
+	return conn, nil
+}
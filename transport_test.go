@@ -0,0 +1,278 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogmigo
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync"
+	"github.com/gorilla/websocket"
+)
+
+// memoryOgmios serves a tiny chain of n blocks along with the tip query and
+// a mempool holding a single transaction
+func memoryOgmios(n int) MemoryHandler {
+	return func(ctx context.Context, conn Conn) {
+		var (
+			height  uint64
+			mempool int
+		)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			var request struct {
+				Method string
+				ID     json.RawMessage
+			}
+			if err := json.Unmarshal(data, &request); err != nil {
+				return
+			}
+
+			response := Map{
+				"jsonrpc": "2.0",
+				"method":  request.Method,
+				"id":      request.ID,
+			}
+			tip := Map{"slot": n * 10, "id": "tip", "height": n}
+			switch request.Method {
+			case "queryLedgerState/tip":
+				response["result"] = tip
+			case chainsync.FindIntersectionMethod:
+				response["result"] = Map{"intersection": "origin", "tip": tip}
+			case chainsync.NextBlockMethod:
+				if int(height) == n {
+					continue // at the tip; await the next block
+				}
+				height++
+				response["result"] = Map{
+					"direction": chainsync.RollForwardString,
+					"tip":       tip,
+					"block": Map{
+						"type":   "praos",
+						"era":    "babbage",
+						"id":     "block",
+						"height": height,
+						"slot":   height * 10,
+					},
+				}
+			case "acquireMempool":
+				mempool = 0
+				response["result"] = Map{"acquired": "mempool", "slot": n * 10}
+			case "nextTransaction":
+				mempool++
+				if mempool == 1 {
+					response["result"] = Map{"transaction": Map{"id": "tx"}}
+				} else {
+					response["result"] = Map{"transaction": nil}
+				}
+			}
+
+			data, _ = json.Marshal(response)
+			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func TestMemoryTransport(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := New(
+		WithTransport(NewMemoryTransport(memoryOgmios(10))),
+		WithLogger(NopLogger),
+	)
+	defer client.Close()
+
+	t.Run("query", func(t *testing.T) {
+		tip, err := client.ChainTip(ctx)
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if ps, ok := tip.PointStruct(); !ok || ps.Slot != 100 {
+			t.Fatalf("got %v; want slot 100", tip)
+		}
+	})
+
+	t.Run("chainsync", func(t *testing.T) {
+		var (
+			blocks int64
+			done   = make(chan struct{})
+		)
+		callback := func(ctx context.Context, data []byte) error {
+			var response chainsync.ResponsePraos
+			if err := json.Unmarshal(data, &response); err != nil {
+				return err
+			}
+			if response.Method == chainsync.NextBlockMethod {
+				if atomic.AddInt64(&blocks, 1) == 10 {
+					close(done)
+				}
+			}
+			return nil
+		}
+
+		closer, err := client.ChainSync(ctx, callback)
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		select {
+		case <-done:
+		case <-ctx.Done():
+			t.Fatalf("timed out after %v blocks", atomic.LoadInt64(&blocks))
+		}
+		if err := closer.Close(); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+	})
+
+	t.Run("mempool", func(t *testing.T) {
+		snapshots := make(chan []*chainsync.Tx, 1)
+		callback := func(ctx context.Context, txs []*chainsync.Tx, slot uint64) error {
+			select {
+			case snapshots <- txs:
+			default:
+			}
+			return nil
+		}
+
+		closer, err := client.MonitorMempool(ctx, callback)
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		defer closer.Close()
+
+		select {
+		case txs := <-snapshots:
+			if len(txs) != 1 || txs[0].ID != "tx" {
+				t.Fatalf("got %v; want single tx", txs)
+			}
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for mempool snapshot")
+		}
+	})
+}
+
+func TestUnixTransport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ogmios.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	//nolint:errcheck
+	defer listener.Close()
+
+	var upgrader = websocket.Upgrader{}
+	handler := memoryOgmios(10)
+	go func() {
+		_ = http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			c, err := upgrader.Upgrade(w, req, nil)
+			if err != nil {
+				return
+			}
+			//nolint:errcheck
+			defer c.Close()
+			handler(req.Context(), c)
+		}))
+	}()
+
+	client := New(
+		WithTransport(NewUnixTransport(path)),
+		WithLogger(NopLogger),
+	)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tip, err := client.ChainTip(ctx)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if ps, ok := tip.PointStruct(); !ok || ps.Slot != 100 {
+		t.Fatalf("got %v; want slot 100", tip)
+	}
+}
+
+func TestWebsocketTransport_credentials(t *testing.T) {
+	var (
+		upgrader = websocket.Upgrader{}
+		handler  = memoryOgmios(10)
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		user, pass, ok := req.BasicAuth()
+		if !ok || user != "user" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if req.Header.Get("Dmtr-Api-Key") != "key" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		c, err := upgrader.Upgrade(w, req, nil)
+		if err != nil {
+			return
+		}
+		//nolint:errcheck
+		defer c.Close()
+		handler(req.Context(), c)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	t.Run("ok", func(t *testing.T) {
+		client := New(
+			WithEndpoint("ws://user:secret@"+strings.TrimPrefix(server.URL, "http://")),
+			WithHeader("Dmtr-Api-Key", "key"),
+			WithLogger(NopLogger),
+		)
+		defer client.Close()
+
+		if _, err := client.ChainTip(ctx); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+	})
+
+	t.Run("redacted", func(t *testing.T) {
+		client := New(
+			WithEndpoint("ws://user:secret@"+strings.TrimPrefix(server.URL, "http://")),
+			WithLogger(NopLogger),
+		)
+		defer client.Close()
+
+		_, err := client.ChainTip(ctx)
+		if err == nil {
+			t.Fatalf("got nil; want error")
+		}
+		if strings.Contains(err.Error(), "secret") {
+			t.Fatalf("got %v; want credentials redacted", err)
+		}
+	})
+}
@@ -17,8 +17,14 @@ package ogmigo
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync"
+	v5 "github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync/v5"
 	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
 	"github.com/buger/jsonparser"
 )
@@ -40,6 +46,24 @@ func (c *Client) evaluateTx(
 	ctx context.Context,
 	data string,
 	additionalUtxos []shared.Utxo,
+) (response *EvaluateTxResponse, err error) {
+	err = c.dispatch(ctx,
+		func(ctx context.Context) (err error) {
+			response, err = c.evaluateTxV6(ctx, data, additionalUtxos)
+			return err
+		},
+		func(ctx context.Context) (err error) {
+			response, err = c.evaluateTxV5(ctx, data, additionalUtxos)
+			return err
+		},
+	)
+	return response, err
+}
+
+func (c *Client) evaluateTxV6(
+	ctx context.Context,
+	data string,
+	additionalUtxos []shared.Utxo,
 ) (response *EvaluateTxResponse, err error) {
 	tx := EvaluateTx{
 		Cbor: data,
@@ -57,6 +81,11 @@ func (c *Client) evaluateTx(
 		raw     json.RawMessage
 	)
 	if err := c.query(ctx, payload, &raw); err != nil {
+		// evaluation failures are reported via the response rather than as an error
+		var e *RPCError
+		if errors.As(err, &e) {
+			return &EvaluateTxResponse{Error: e}, nil
+		}
 		return nil, fmt.Errorf("failed to evaluate tx: %w", err)
 	}
 
@@ -96,11 +125,9 @@ type ExUnitsBudget struct {
 	Cpu    uint64 `json:"cpu"`
 }
 
-type EvaluateTxError struct {
-	Code    int
-	Message string
-	Data    json.RawMessage
-}
+// EvaluateTxError describes why ogmios could not evaluate a transaction;
+// errors.Is matches ErrEvaluationFailed
+type EvaluateTxError = RPCError
 
 type EvaluateTxResponse struct {
 	ExUnits []ExUnits
@@ -138,7 +165,7 @@ func readEvaluateTxError(data []byte) (*EvaluateTxError, error) {
 			data,
 		)
 	}
-	var e EvaluateTxError
+	e := EvaluateTxError{Method: "evaluateTransaction"}
 	if err := json.Unmarshal(value, &e); err != nil {
 		return nil, fmt.Errorf(
 			"failed to parse EvaluateTx error: %w %s",
@@ -173,3 +200,86 @@ func readEvaluateTxResult(data []byte) ([]ExUnits, error) {
 		return nil, fmt.Errorf("failed to parser EvaluateTx response: %w", err)
 	}
 }
+
+// codeEvaluationFailureV5 is the code reported for transactions ogmios v5
+// failed to evaluate, as v5 does not assign codes to its failures
+const codeEvaluationFailureV5 = 3000
+
+// evaluateTxV5 evaluates the transaction with ogmios v5, converting the
+// result to the v6 response
+func (c *Client) evaluateTxV5(
+	ctx context.Context,
+	data string,
+	additionalUtxos []shared.Utxo,
+) (*EvaluateTxResponse, error) {
+	arguments := Map{
+		"evaluate": data,
+	}
+	if len(additionalUtxos) > 0 {
+		var utxos [][]interface{}
+		for _, u := range additionalUtxos {
+			txIn := v5.TxInV5{TxHash: u.Transaction.ID, Index: int(u.Index)}
+			txOut := v5.TxOutFromV6(chainsync.TxOut{
+				Address:   u.Address,
+				Datum:     u.Datum,
+				DatumHash: u.DatumHash,
+				Value:     u.Value,
+				Script:    u.Script,
+			})
+			utxos = append(utxos, []interface{}{txIn, txOut})
+		}
+		arguments["additionalUtxoSet"] = utxos
+	}
+
+	var (
+		payload = makePayloadV5("EvaluateTx", arguments)
+		content struct {
+			Result struct {
+				EvaluationResult map[string]struct {
+					Memory uint64 `json:"memory"`
+					Steps  uint64 `json:"steps"`
+				}
+				EvaluationFailure json.RawMessage
+			}
+		}
+	)
+	if err := c.query(ctx, payload, &content); err != nil {
+		return nil, fmt.Errorf("failed to evaluate tx: %w", err)
+	}
+
+	if failure := content.Result.EvaluationFailure; len(failure) > 0 {
+		return &EvaluateTxResponse{
+			Error: &EvaluateTxError{
+				Code:    codeEvaluationFailureV5,
+				Message: "EvaluationFailure",
+				Data:    failure,
+				Method:  "evaluateTransaction",
+			},
+		}, nil
+	}
+
+	// v5 identifies validators as purpose:index e.g. spend:0
+	var units []ExUnits
+	for key, budget := range content.Result.EvaluationResult {
+		purpose, index, ok := strings.Cut(key, ":")
+		if !ok {
+			return nil, fmt.Errorf("failed to parse EvaluateTx validator, %v", key)
+		}
+		i, err := strconv.ParseUint(index, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse EvaluateTx validator, %v: %w", key, err)
+		}
+		units = append(units, ExUnits{
+			Validator: Validator{Purpose: purpose, Index: i},
+			Budget:    ExUnitsBudget{Memory: budget.Memory, Cpu: budget.Steps},
+		})
+	}
+	sort.Slice(units, func(i, j int) bool {
+		a, b := units[i].Validator, units[j].Validator
+		if a.Purpose != b.Purpose {
+			return a.Purpose < b.Purpose
+		}
+		return a.Index < b.Index
+	})
+	return &EvaluateTxResponse{ExUnits: units}, nil
+}
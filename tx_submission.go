@@ -49,9 +49,30 @@ type SubmitTx struct {
 
 // SubmitTx submits the transaction via ogmios
 // https://ogmios.dev/mini-protocols/local-tx-submission/
+//
+// Rejections by ogmios v5 are reported with code codeSubmitFailV5 and the v5
+// failures as Data; as ogmios v5 does not echo the transaction id, ID is
+// empty on success.
 func (c *Client) SubmitTx(
 	ctx context.Context,
 	data string,
+) (s *SubmitTxResponse, err error) {
+	err = c.dispatch(ctx,
+		func(ctx context.Context) (err error) {
+			s, err = c.submitTx(ctx, data)
+			return err
+		},
+		func(ctx context.Context) (err error) {
+			s, err = c.submitTxV5(ctx, data)
+			return err
+		},
+	)
+	return s, err
+}
+
+func (c *Client) submitTx(
+	ctx context.Context,
+	data string,
 ) (s *SubmitTxResponse, err error) {
 	tx := SubmitTx{
 		Cbor: data,
@@ -65,6 +86,11 @@ func (c *Client) SubmitTx(
 		raw json.RawMessage
 	)
 	if err := c.query(ctx, payload, &raw); err != nil {
+		// rejections are reported via the response rather than as an error
+		var e *RPCError
+		if errors.As(err, &e) {
+			return &SubmitTxResponse{Error: e}, nil
+		}
 		return nil, fmt.Errorf("failed to submit TX: %w", err)
 	}
 
@@ -98,11 +124,9 @@ type SubmitTxResponse struct {
 	Error *SubmitTxError
 }
 
-type SubmitTxError struct {
-	Code    int
-	Message string
-	Data    json.RawMessage
-}
+// SubmitTxError describes why ogmios rejected a transaction; errors.Is
+// matches ErrSubmissionRejected
+type SubmitTxError = RPCError
 
 func readSubmitTxError(data []byte) (*SubmitTxError, error) {
 	value, _, _, err := jsonparser.Get(data, "error")
@@ -113,7 +137,7 @@ func readSubmitTxError(data []byte) (*SubmitTxError, error) {
 			data,
 		)
 	}
-	var e SubmitTxError
+	e := SubmitTxError{Method: "submitTransaction"}
 	if err := json.Unmarshal(value, &e); err != nil {
 		return nil, fmt.Errorf(
 			"failed to parse SubmitTx error: %w %s",
@@ -161,6 +185,36 @@ func (c *Client) SubmitTxV5(ctx context.Context, data string) (err error) {
 	return readSubmitTxV5(raw)
 }
 
+// codeSubmitFailV5 is the code reported for transactions rejected by ogmios
+// v5, which does not assign codes to its failures
+const codeSubmitFailV5 = 3000
+
+// submitTxV5 submits the transaction to ogmios v5, converting the result to
+// the v6 response
+func (c *Client) submitTxV5(ctx context.Context, data string) (*SubmitTxResponse, error) {
+	err := c.SubmitTxV5(ctx, data)
+	if err == nil {
+		return &SubmitTxResponse{}, nil
+	}
+
+	var e SubmitTxErrorV5
+	if !errors.As(err, &e) {
+		return nil, err
+	}
+	messages, err := json.Marshal(e.messages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode SubmitTx failures: %w", err)
+	}
+	return &SubmitTxResponse{
+		Error: &SubmitTxError{
+			Code:    codeSubmitFailV5,
+			Message: e.Error(),
+			Data:    messages,
+			Method:  "submitTransaction",
+		},
+	}, nil
+}
+
 // SubmitTxError encapsulates the SubmitTx errors and allows the results to be parsed
 type SubmitTxErrorV5 struct {
 	messages []json.RawMessage
@@ -17,37 +17,40 @@ package ogmigo
 // Map provides a simple type alias
 type Map map[string]interface{}
 
-type circular struct {
+type circular[T any] struct {
 	index int
-	data  [][]byte
+	count int
+	data  []T
 }
 
 type SubmitTxPayload struct {
 	CBOR string `json:"cbor"`
 }
 
-func newCircular(cap int) *circular {
-	return &circular{
-		data: make([][]byte, cap),
+func newCircular[T any](cap int) *circular[T] {
+	return &circular[T]{
+		data: make([]T, cap),
 	}
 }
 
-func (c *circular) add(data []byte) {
-	c.data[c.index] = data
+func (c *circular[T]) add(v T) {
+	c.data[c.index] = v
 	c.index = (c.index + 1) % len(c.data)
+	if c.count < len(c.data) {
+		c.count++
+	}
 }
 
-func (c *circular) list() (data [][]byte) {
-	for i := 0; i < len(c.data); i++ {
-		offset := (c.index + i) % len(c.data)
-		if v := c.data[offset]; len(v) > 0 {
-			data = append(data, v)
-		}
+// list returns the entries from oldest to newest
+func (c *circular[T]) list() (data []T) {
+	start := c.index - c.count + len(c.data)
+	for i := 0; i < c.count; i++ {
+		data = append(data, c.data[(start+i)%len(c.data)])
 	}
 	return data
 }
 
-func (c *circular) prefix(data ...[]byte) [][]byte {
+func (c *circular[T]) prefix(data ...T) []T {
 	return append(data, c.list()...)
 }
 
@@ -57,7 +57,7 @@ func Test_circular_list(t *testing.T) {
 
 	for label, tc := range tests {
 		t.Run(label, func(t *testing.T) {
-			c := newCircular(3)
+			c := newCircular[[]byte](3)
 			for _, data := range tc.Inputs {
 				c.add(data)
 			}
@@ -0,0 +1,128 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogmigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/buger/jsonparser"
+)
+
+// Version identifies the major version of the ogmios server
+type Version int32
+
+const (
+	// VersionUnknown indicates the server has not yet been probed
+	VersionUnknown Version = iota
+	// Version5 speaks jsonwsp e.g. ogmios v5.x
+	Version5
+	// Version6 speaks JSON-RPC 2.0 e.g. ogmios v6.x
+	Version6
+)
+
+func (v Version) String() string {
+	switch v {
+	case Version5:
+		return "v5"
+	case Version6:
+		return "v6"
+	default:
+		return "unknown"
+	}
+}
+
+// versionError indicates the server rejected a request because it speaks
+// the wire format of another version
+type versionError struct {
+	version Version
+}
+
+func (v *versionError) Error() string {
+	return fmt.Sprintf("request rejected by ogmios %v", v.version)
+}
+
+// rejectedBy reports the version of the server that sent the response, for
+// responses that cannot be routed to a request.  Both ogmios v5 and v6 reply
+// without a request id when they are unable to parse the request, which is
+// how each responds to the wire format of the other.
+func rejectedBy(data []byte) (Version, bool) {
+	if t, _ := jsonparser.GetString(data, "type"); t == string(fault) {
+		return Version5, true
+	}
+	if _, _, _, err := jsonparser.Get(data, "error"); err == nil {
+		if _, err := jsonparser.GetString(data, "jsonrpc"); err == nil {
+			return Version6, true
+		}
+	}
+	return VersionUnknown, false
+}
+
+// ServerVersion returns the major version of the ogmios server.  The version
+// is detected by the first request the Client makes and then cached; if no
+// request has been made yet, the chain tip is queried to detect it.  All
+// endpoints of a Client are expected to run the same major version.
+func (c *Client) ServerVersion(ctx context.Context) (Version, error) {
+	if v := c.serverVersion(); v != VersionUnknown {
+		return v, nil
+	}
+	if _, err := c.ChainTip(ctx); err != nil {
+		return VersionUnknown, fmt.Errorf("failed to detect ogmios version: %w", err)
+	}
+	return c.serverVersion(), nil
+}
+
+func (c *Client) serverVersion() Version {
+	return Version(atomic.LoadInt32(&c.version))
+}
+
+func (c *Client) setServerVersion(v Version) {
+	if old := atomic.SwapInt32(&c.version, int32(v)); Version(old) != v {
+		c.logger.Info("ogmios server version detected", KV("version", v.String()))
+	}
+}
+
+// dispatch invokes v5 or v6 according to the server version.  Until the
+// version is known v6 is assumed; should the server reject the request as
+// ogmios v5, the version is cached and the request retried with v5.  A nil
+// v5 indicates the request has no ogmios v5 equivalent.
+func (c *Client) dispatch(ctx context.Context, v6, v5 func(ctx context.Context) error) error {
+	for attempt := 0; ; attempt++ {
+		version := c.serverVersion()
+		fn := v6
+		if version == Version5 {
+			fn = v5
+		}
+		if fn == nil {
+			return fmt.Errorf("request not supported by ogmios %v", version)
+		}
+
+		err := fn(ctx)
+		var ve *versionError
+		if errors.As(err, &ve) && ve.version != version && attempt == 0 {
+			c.setServerVersion(ve.version)
+			continue
+		}
+		if version == VersionUnknown {
+			var re *RPCError
+			if err == nil || errors.As(err, &re) {
+				c.setServerVersion(Version6)
+			}
+		}
+		return err
+	}
+}
@@ -0,0 +1,303 @@
+// Copyright 2021 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ogmigo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/chainsync"
+	"github.com/SundaeSwap-finance/ogmigo/v6/ouroboros/shared"
+	"github.com/gorilla/websocket"
+)
+
+// memoryOgmiosV5 mimics ogmios v5, answering jsonwsp requests via fn and
+// rejecting JSON-RPC requests with a fault.  rejected counts the JSON-RPC
+// requests received.
+func memoryOgmiosV5(
+	rejected *int64,
+	fn func(method string, args json.RawMessage) interface{},
+) MemoryHandler {
+	return func(ctx context.Context, conn Conn) {
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			var request struct {
+				JSONRPC    string
+				MethodName string `json:"methodname"`
+				Args       json.RawMessage
+				Mirror     json.RawMessage
+			}
+			if err := json.Unmarshal(data, &request); err != nil {
+				return
+			}
+
+			response := Map{
+				"type":        "jsonwsp/response",
+				"version":     "1.0",
+				"servicename": "ogmios",
+				"methodname":  request.MethodName,
+				"reflection":  request.Mirror,
+			}
+			if request.JSONRPC != "" {
+				atomic.AddInt64(rejected, 1)
+				response = Map{
+					"type":        "jsonwsp/fault",
+					"version":     "1.0",
+					"servicename": "ogmios",
+					"fault":       Map{"code": "client", "string": "invalid request"},
+					"reflection":  nil,
+				}
+			} else {
+				response["result"] = fn(request.MethodName, request.Args)
+			}
+
+			data, err = json.Marshal(response)
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func TestClient_ServerVersion(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	t.Run("v5", func(t *testing.T) {
+		var rejected int64
+		client := New(WithTransport(NewMemoryTransport(memoryOgmiosV5(&rejected, func(string, json.RawMessage) interface{} {
+			return Map{"slot": 123, "hash": "abc"}
+		}))))
+		defer client.Close()
+
+		for i := 0; i < 2; i++ {
+			point, err := client.ChainTip(ctx)
+			if err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			ps, ok := point.PointStruct()
+			if !ok || ps.Slot != 123 || ps.ID != "abc" {
+				t.Fatalf("got %v; want slot 123, id abc", point)
+			}
+		}
+		if got, want := atomic.LoadInt64(&rejected), int64(1); got != want {
+			t.Fatalf("got %v rejected; want %v", got, want)
+		}
+
+		version, err := client.ServerVersion(ctx)
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if version != Version5 {
+			t.Fatalf("got %v; want %v", version, Version5)
+		}
+
+		if _, err := client.GenesisConfig(ctx, "shelley"); err == nil {
+			t.Fatalf("got nil; want err")
+		}
+		if _, err := client.CurrentProtocolParameters(ctx); err == nil {
+			t.Fatalf("got nil; want err")
+		}
+		params, err := client.CurrentProtocolParametersV5(ctx)
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := string(params), `{"hash":"abc","slot":123}`; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("v6", func(t *testing.T) {
+		client := New(WithTransport(NewMemoryTransport(memoryOgmios(10))))
+		defer client.Close()
+
+		version, err := client.ServerVersion(ctx)
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if version != Version6 {
+			t.Fatalf("got %v; want %v", version, Version6)
+		}
+	})
+}
+
+func TestClient_DispatchV5(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var rejected int64
+	client := New(WithTransport(NewMemoryTransport(memoryOgmiosV5(&rejected, func(method string, args json.RawMessage) interface{} {
+		switch method {
+		case "SubmitTx":
+			return Map{"SubmitFail": []interface{}{Map{"badInputs": []string{"abc#0"}}}}
+		case "EvaluateTx":
+			return Map{"EvaluationResult": Map{
+				"spend:1": Map{"memory": 10, "steps": 20},
+				"mint:0":  Map{"memory": 30, "steps": 40},
+			}}
+		}
+
+		var query struct{ Query json.RawMessage }
+		_ = json.Unmarshal(args, &query)
+		switch string(query.Query) {
+		case `"eraSummaries"`:
+			return []Map{
+				{
+					"start":      Map{"time": 0, "slot": 0, "epoch": 0},
+					"end":        Map{"time": 89856000, "slot": 4492800, "epoch": 208},
+					"parameters": Map{"epochLength": 21600, "slotLength": 20, "safeZone": 4320},
+				},
+				{
+					"start":      Map{"time": 89856000, "slot": 4492800, "epoch": 208},
+					"end":        nil,
+					"parameters": Map{"epochLength": 432000, "slotLength": 1, "safeZone": 129600},
+				},
+			}
+		case `"eraStart"`:
+			return Map{"time": 89856000, "slot": 4492800, "epoch": 208}
+		default: // utxo
+			return []interface{}{
+				[]interface{}{
+					Map{"txId": "abc", "index": 2},
+					Map{"address": "addr", "value": Map{"coins": 5, "assets": Map{"policy.asset": 7}}},
+				},
+			}
+		}
+	}))))
+	defer client.Close()
+
+	t.Run("utxos", func(t *testing.T) {
+		utxos, err := client.UtxosByTxIn(ctx, chainsync.TxInQuery{
+			Transaction: shared.UtxoTxID{ID: "abc"},
+			Index:       2,
+		})
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if len(utxos) != 1 {
+			t.Fatalf("got %v utxos; want 1", len(utxos))
+		}
+		utxo := utxos[0]
+		if utxo.Transaction.ID != "abc" || utxo.Index != 2 || utxo.Address != "addr" {
+			t.Fatalf("got %#v; want abc#2 at addr", utxo)
+		}
+		if got, want := utxo.Value.AdaLovelace().Uint64(), uint64(5); got != want {
+			t.Fatalf("got %v lovelace; want %v", got, want)
+		}
+		if got, want := utxo.Value.AssetsExceptAda()["policy"]["asset"].Uint64(), uint64(7); got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("era summaries", func(t *testing.T) {
+		history, err := client.EraSummaries(ctx)
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := len(history.Summaries), 2; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := history.Summaries[0].Parameters.SlotLength.Milliseconds.Uint64(), uint64(20000); got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := history.Summaries[1].Start.Time.Seconds.Uint64(), uint64(89856000); got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+
+		start, err := client.EraStart(ctx)
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := start.Epoch.Uint64(), uint64(208); got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("submit", func(t *testing.T) {
+		response, err := client.SubmitTx(ctx, "00")
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if response.Error == nil {
+			t.Fatalf("got nil; want submit error")
+		}
+		if !errors.Is(response.Error, ErrSubmissionRejected) {
+			t.Fatalf("got %v; want ErrSubmissionRejected", response.Error)
+		}
+		if got, want := string(response.Error.Data), `[{"badInputs":["abc#0"]}]`; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("evaluate", func(t *testing.T) {
+		response, err := client.EvaluateTx(ctx, "00")
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		want := []ExUnits{
+			{Validator: Validator{Purpose: "mint", Index: 0}, Budget: ExUnitsBudget{Memory: 30, Cpu: 40}},
+			{Validator: Validator{Purpose: "spend", Index: 1}, Budget: ExUnitsBudget{Memory: 10, Cpu: 20}},
+		}
+		if got := response.ExUnits; len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	if got, want := atomic.LoadInt64(&rejected), int64(1); got != want {
+		t.Fatalf("got %v rejected; want %v", got, want)
+	}
+}
+
+func TestRejectedBy(t *testing.T) {
+	tests := map[string]struct {
+		data    string
+		version Version
+		ok      bool
+	}{
+		"v5 fault": {
+			data:    `{"type":"jsonwsp/fault","version":"1.0","servicename":"ogmios","fault":{"code":"client","string":"nope"},"reflection":null}`,
+			version: Version5,
+			ok:      true,
+		},
+		"v6 error": {
+			data:    `{"jsonrpc":"2.0","error":{"code":-32600,"message":"invalid request"},"id":null}`,
+			version: Version6,
+			ok:      true,
+		},
+		"notification": {
+			data: `{"jsonrpc":"2.0","method":"nextBlock","result":{}}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			version, ok := rejectedBy([]byte(tc.data))
+			if version != tc.version || ok != tc.ok {
+				t.Fatalf("got %v, %v; want %v, %v", version, ok, tc.version, tc.ok)
+			}
+		})
+	}
+}
@@ -18,66 +18,35 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"sync/atomic"
+	"sync"
+	"time"
 
+	"github.com/buger/jsonparser"
 	"github.com/gorilla/websocket"
 )
 
 var fault = []byte(`jsonwsp/fault`)
 
+// errConnClosed indicates the pooled connection was closed by the client
+var errConnClosed = errors.New("ogmios connection closed")
+
 func (c *Client) query(
 	ctx context.Context,
-	payload interface{},
+	payload Map,
 	v interface{},
-) (err error) {
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
-
-	var (
-		ch     = make(chan error, 1)
-		conn   *websocket.Conn
-		closed int64 // ensures close is only called once
-	)
-	go func() {
-		<-ctx.Done()
-		if conn != nil {
-			ch <- ctx.Err()
-			if v := atomic.AddInt64(&closed, 1); v == 1 {
-				_ = conn.Close()
-			}
-		}
-	}()
-
-	conn, _, err = websocket.DefaultDialer.DialContext(
-		ctx,
-		c.options.endpoint,
-		nil,
-	)
+) error {
+	raw, err := c.roundTrip(ctx, payload)
 	if err != nil {
-		return fmt.Errorf(
-			"failed to connect to ogmios, %v: %w",
-			c.options.endpoint,
-			err,
-		)
-	}
-	defer func() {
-		if v := atomic.AddInt64(&closed, 1); v == 1 {
-			_ = conn.Close()
-		} else {
-			err = <-ch
-		}
-	}()
-
-	if err := conn.WriteJSON(payload); err != nil {
-		return fmt.Errorf("failed to submit request: %w", err)
-	}
-
-	var raw json.RawMessage
-	if err := conn.ReadJSON(&raw); err != nil {
-		return fmt.Errorf("failed to read json response: %w", err)
+		return err
 	}
+	return decodeResponse(raw, v)
+}
 
+// decodeResponse unmarshals the raw response into v, surfacing any error
+// reported by ogmios as an Error (v5) or *RPCError (v6)
+func decodeResponse(raw []byte, v interface{}) error {
 	if bytes.Contains(raw, fault) {
 		var e Error
 		if err := json.Unmarshal(raw, &e); err != nil {
@@ -85,6 +54,11 @@ func (c *Client) query(
 		}
 		return e
 	}
+	if e, ok, err := readRPCError(raw); err != nil {
+		return err
+	} else if ok {
+		return e
+	}
 
 	if v != nil {
 		if err := json.Unmarshal(raw, v); err != nil {
@@ -94,3 +68,390 @@ func (c *Client) query(
 
 	return nil
 }
+
+// roundTrip sends the payload over a pooled connection to the healthiest
+// endpoint and waits for the response carrying the same request id.  If an
+// endpoint cannot be reached, the next healthiest is tried.
+func (c *Client) roundTrip(ctx context.Context, payload Map) ([]byte, error) {
+	return c.intercept(ctx, c.newRequest(payload), func(ctx context.Context, req *Request) ([]byte, error) {
+		data, err := req.encode()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range c.endpoints.order() {
+			var raw []byte
+			raw, err = c.roundTripEndpoint(ctx, e, req.ID, data)
+			if err == nil {
+				return raw, nil
+			}
+			var de *dialError
+			if !errors.As(err, &de) || ctx.Err() != nil {
+				return nil, err
+			}
+		}
+		return nil, err
+	})
+}
+
+// queryEndpoint is equivalent to query, but is restricted to a single endpoint
+func (c *Client) queryEndpoint(
+	ctx context.Context,
+	e *endpoint,
+	payload Map,
+	v interface{},
+) error {
+	raw, err := c.intercept(ctx, c.newRequest(payload), func(ctx context.Context, req *Request) ([]byte, error) {
+		data, err := req.encode()
+		if err != nil {
+			return nil, err
+		}
+		return c.roundTripEndpoint(ctx, e, req.ID, data)
+	})
+	if err != nil {
+		return err
+	}
+	return decodeResponse(raw, v)
+}
+
+func (c *Client) roundTripEndpoint(
+	ctx context.Context,
+	e *endpoint,
+	id uint64,
+	data []byte,
+) ([]byte, error) {
+	// a write that fails on a stale connection never reached ogmios, so it is
+	// safe to retry once on a freshly dialed connection
+	for attempt := 0; ; attempt++ {
+		conn, err := e.pool.get(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				c.endpoints.failed(e)
+			}
+			return nil, &dialError{err: err}
+		}
+
+		started := time.Now()
+		raw, err := conn.roundTrip(ctx, id, data)
+		if err != nil {
+			var we *writeError
+			if errors.As(err, &we) && attempt == 0 {
+				e.pool.remove(conn)
+				continue
+			}
+			return nil, err
+		}
+		c.endpoints.succeeded(e, time.Since(started))
+		return raw, nil
+	}
+}
+
+// responseID extracts the request id from a JSON-RPC or jsonwsp response
+func responseID(data []byte) (uint64, bool) {
+	if v, err := jsonparser.GetInt(data, "id"); err == nil && v > 0 {
+		return uint64(v), true
+	}
+	if v, err := jsonparser.GetInt(data, "reflection", "id"); err == nil && v > 0 {
+		return uint64(v), true
+	}
+	return 0, false
+}
+
+// dialError indicates a connection to the endpoint could not be established
+type dialError struct {
+	err error
+}
+
+func (d *dialError) Error() string { return d.err.Error() }
+
+func (d *dialError) Unwrap() error { return d.err }
+
+// writeError indicates a request could not be written to the connection
+type writeError struct {
+	err error
+}
+
+func (w *writeError) Error() string { return "failed to submit request: " + w.err.Error() }
+
+func (w *writeError) Unwrap() error { return w.err }
+
+// connPool holds the long-lived connections used for one-shot requests
+type connPool struct {
+	client   *Client
+	endpoint string
+	size     int
+
+	mutex   sync.Mutex
+	conns   []*rpcConn
+	next    int
+	dialing int           // connections being dialed, which count towards size
+	dialed  chan struct{} // closed once a dial completes, if awaited
+	closed  bool
+}
+
+func newConnPool(client *Client, endpoint string, size int) *connPool {
+	return &connPool{
+		client:   client,
+		endpoint: endpoint,
+		size:     size,
+	}
+}
+
+// get returns a live connection, dialing a new one if the pool is not yet
+// full.  Dialing happens outside the lock, so a slow handshake holds up only
+// the requests with no connection to share.
+func (p *connPool) get(ctx context.Context) (*rpcConn, error) {
+	for {
+		p.mutex.Lock()
+		if p.closed {
+			p.mutex.Unlock()
+			return nil, errConnClosed
+		}
+		if len(p.conns)+p.dialing < p.size {
+			p.dialing++
+			p.mutex.Unlock()
+			return p.dial(ctx)
+		}
+		if len(p.conns) > 0 {
+			p.next = (p.next + 1) % len(p.conns)
+			conn := p.conns[p.next]
+			p.mutex.Unlock()
+			return conn, nil
+		}
+
+		// every connection is still being dialed
+		if p.dialed == nil {
+			p.dialed = make(chan struct{})
+		}
+		dialed := p.dialed
+		p.mutex.Unlock()
+
+		select {
+		case <-dialed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// dial connects to the endpoint and adds the connection to the pool, whose
+// size already accounts for it
+func (p *connPool) dial(ctx context.Context) (*rpcConn, error) {
+	conn, err := p.client.dialRPC(ctx, p.endpoint)
+
+	p.mutex.Lock()
+	p.dialing--
+	if p.dialed != nil {
+		close(p.dialed)
+		p.dialed = nil
+	}
+	closed := p.closed
+	if err == nil && !closed {
+		p.conns = append(p.conns, conn)
+	}
+	p.mutex.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+	if closed {
+		conn.close(errConnClosed)
+		return nil, errConnClosed
+	}
+	go func() {
+		<-conn.done
+		p.remove(conn)
+	}()
+	return conn, nil
+}
+
+// remove drops the connection from the pool and closes it
+func (p *connPool) remove(conn *rpcConn) {
+	p.mutex.Lock()
+	for i, c := range p.conns {
+		if c == conn {
+			p.conns = append(p.conns[:i], p.conns[i+1:]...)
+			break
+		}
+	}
+	p.mutex.Unlock()
+
+	conn.close(errConnClosed)
+}
+
+// close closes all pooled connections; subsequent requests fail
+func (p *connPool) close() {
+	p.mutex.Lock()
+	conns := p.conns
+	p.conns = nil
+	p.closed = true
+	p.mutex.Unlock()
+
+	for _, conn := range conns {
+		conn.close(errConnClosed)
+	}
+}
+
+type rpcResult struct {
+	data []byte
+	err  error
+}
+
+// rpcWaiter awaits the response to a single request
+type rpcWaiter struct {
+	ch      chan rpcResult
+	jsonrpc bool // request uses the v6 wire format
+}
+
+// rpcConn multiplexes concurrent requests over a single connection, routing
+// each response to its waiter by request id
+type rpcConn struct {
+	conn   Conn
+	logger Logger
+
+	writeMutex sync.Mutex // websocket allows only one concurrent writer
+
+	mutex   sync.Mutex
+	pending map[uint64]rpcWaiter
+	err     error
+
+	once sync.Once
+	done chan struct{}
+}
+
+func (c *Client) dialRPC(ctx context.Context, endpoint string) (*rpcConn, error) {
+	conn, err := c.dialEndpoint(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	rc := &rpcConn{
+		conn:    conn,
+		logger:  c.logger,
+		pending: map[uint64]rpcWaiter{},
+		done:    make(chan struct{}),
+	}
+	go rc.readLoop()
+
+	c.logger.Debug("ogmigo query connection opened")
+	return rc, nil
+}
+
+func (r *rpcConn) readLoop() {
+	for {
+		messageType, data, err := r.conn.ReadMessage()
+		if err != nil {
+			r.close(fmt.Errorf("failed to read json response: %w", err))
+			return
+		}
+		if messageType != websocket.TextMessage {
+			continue
+		}
+
+		id, ok := responseID(data)
+		if !ok {
+			if version, ok := rejectedBy(data); ok {
+				r.reject(version)
+				continue
+			}
+			r.logger.Info("skipping response without request id")
+			continue
+		}
+
+		r.mutex.Lock()
+		w, ok := r.pending[id]
+		delete(r.pending, id)
+		r.mutex.Unlock()
+
+		if ok {
+			w.ch <- rpcResult{data: data}
+		}
+	}
+}
+
+func (r *rpcConn) roundTrip(
+	ctx context.Context,
+	id uint64,
+	data []byte,
+) ([]byte, error) {
+	ch := make(chan rpcResult, 1)
+	_, err := jsonparser.GetString(data, "jsonrpc")
+
+	r.mutex.Lock()
+	if r.err != nil {
+		r.mutex.Unlock()
+		return nil, &writeError{err: r.err}
+	}
+	r.pending[id] = rpcWaiter{ch: ch, jsonrpc: err == nil}
+	r.mutex.Unlock()
+
+	if err := r.write(ctx, data); err != nil {
+		r.forget(id)
+		return nil, &writeError{err: err}
+	}
+
+	select {
+	case <-ctx.Done():
+		r.forget(id)
+		return nil, ctx.Err()
+	case result := <-ch:
+		return result.data, result.err
+	}
+}
+
+func (r *rpcConn) write(ctx context.Context, data []byte) error {
+	r.writeMutex.Lock()
+	defer r.writeMutex.Unlock()
+
+	var deadline time.Time
+	if v, ok := ctx.Deadline(); ok {
+		deadline = v
+	}
+	if err := r.conn.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+	return r.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// reject fails the pending requests written in the wire format of a version
+// other than the server's
+func (r *rpcConn) reject(version Version) {
+	r.mutex.Lock()
+	var rejected []rpcWaiter
+	for id, w := range r.pending {
+		if w.jsonrpc != (version == Version6) {
+			rejected = append(rejected, w)
+			delete(r.pending, id)
+		}
+	}
+	r.mutex.Unlock()
+
+	for _, w := range rejected {
+		w.ch <- rpcResult{err: &versionError{version: version}}
+	}
+}
+
+func (r *rpcConn) forget(id uint64) {
+	r.mutex.Lock()
+	delete(r.pending, id)
+	r.mutex.Unlock()
+}
+
+// close shuts down the connection and fails any requests still waiting on it
+func (r *rpcConn) close(err error) {
+	r.once.Do(func() {
+		r.mutex.Lock()
+		r.err = err
+		pending := r.pending
+		r.pending = map[uint64]rpcWaiter{}
+		r.mutex.Unlock()
+
+		_ = r.conn.Close()
+		close(r.done)
+
+		for _, w := range pending {
+			w.ch <- rpcResult{err: err}
+		}
+		r.logger.Debug("ogmigo query connection closed")
+	})
+}
@@ -2,12 +2,17 @@ package ogmigo
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"math/rand"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -77,3 +82,270 @@ func TestClient_query(t *testing.T) {
 		t.Fatalf("expected context.Canceled; got %v", err)
 	}
 }
+
+// echoParams replies to each request with its params as the result, after a
+// random delay so responses arrive out of order; params mentioning "slow" are
+// delayed by a second
+func echoParams(connections *int64, closeAfter int) http.HandlerFunc {
+	var upgrader = websocket.Upgrader{}
+	return func(w http.ResponseWriter, req *http.Request) {
+		c, err := upgrader.Upgrade(w, req, nil)
+		if err != nil {
+			log.Print("upgrade:", err)
+			return
+		}
+		//nolint:errcheck
+		defer c.Close()
+		atomic.AddInt64(connections, 1)
+
+		var (
+			wg    sync.WaitGroup
+			mutex sync.Mutex
+		)
+		defer wg.Wait()
+
+		for n := 0; closeAfter == 0 || n < closeAfter; n++ {
+			_, message, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			var request struct {
+				ID     json.RawMessage
+				Params json.RawMessage
+			}
+			if err := json.Unmarshal(message, &request); err != nil {
+				return
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				delay := time.Duration(rand.Intn(10)) * time.Millisecond
+				if strings.Contains(string(request.Params), "slow") {
+					delay = time.Second
+				}
+				time.Sleep(delay)
+
+				mutex.Lock()
+				defer mutex.Unlock()
+				_ = c.WriteJSON(Map{
+					"jsonrpc": "2.0",
+					"result":  request.Params,
+					"id":      request.ID,
+				})
+			}()
+		}
+	}
+}
+
+func TestClient_queryMultiplexed(t *testing.T) {
+	var connections int64
+	server := httptest.NewServer(echoParams(&connections, 0))
+	defer server.Close()
+
+	client := New(
+		WithEndpoint("ws"+strings.TrimPrefix(server.URL, "http")),
+		WithLogger(NopLogger),
+	)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			era := fmt.Sprintf("era-%v", i)
+			got, err := client.GenesisConfig(ctx, era)
+			if err != nil {
+				t.Errorf("got %v; want nil", err)
+				return
+			}
+			if want := fmt.Sprintf(`{"era":%q}`, era); string(got) != want {
+				t.Errorf("got %v; want %v", string(got), want)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got, want := atomic.LoadInt64(&connections), int64(1); got != want {
+		t.Fatalf("got %v connections; want %v", got, want)
+	}
+}
+
+// gatedTransport holds every dial after the first until gate is closed
+type gatedTransport struct {
+	Transport
+	dials int64
+	gate  chan struct{}
+}
+
+func (g *gatedTransport) Dial(ctx context.Context, endpoint string) (Conn, error) {
+	if atomic.AddInt64(&g.dials, 1) > 1 {
+		select {
+		case <-g.gate:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return g.Transport.Dial(ctx, endpoint)
+}
+
+func TestClient_querySlowDial(t *testing.T) {
+	var connections int64
+	server := httptest.NewServer(echoParams(&connections, 0))
+	defer server.Close()
+
+	transport := &gatedTransport{
+		Transport: NewWebsocketTransport(nil, nil),
+		gate:      make(chan struct{}),
+	}
+	client := New(
+		WithEndpoint("ws"+strings.TrimPrefix(server.URL, "http")),
+		WithTransport(transport),
+		WithQueryConnections(2),
+		WithLogger(NopLogger),
+	)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := client.GenesisConfig(ctx, "first"); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.GenesisConfig(ctx, "second")
+		done <- err
+	}()
+	for atomic.LoadInt64(&transport.dials) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// while the second connection is still dialing, the first remains usable
+	short, cancelShort := context.WithTimeout(ctx, time.Second)
+	defer cancelShort()
+	if _, err := client.GenesisConfig(short, "idle"); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	close(transport.gate)
+	if err := <-done; err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := atomic.LoadInt64(&transport.dials), int64(2); got != want {
+		t.Fatalf("got %v dials; want %v", got, want)
+	}
+}
+
+func TestClient_queryReconnect(t *testing.T) {
+	var connections int64
+	server := httptest.NewServer(echoParams(&connections, 1))
+	defer server.Close()
+
+	client := New(
+		WithEndpoint("ws"+strings.TrimPrefix(server.URL, "http")),
+		WithLogger(NopLogger),
+	)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.GenesisConfig(ctx, "shelley"); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		// allow the server side close to propagate
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if got, want := atomic.LoadInt64(&connections), int64(3); got != want {
+		t.Fatalf("got %v connections; want %v", got, want)
+	}
+}
+
+func TestClient_queryTimeout(t *testing.T) {
+	var connections int64
+	server := httptest.NewServer(echoParams(&connections, 0))
+	defer server.Close()
+
+	client := New(
+		WithEndpoint("ws"+strings.TrimPrefix(server.URL, "http")),
+		WithLogger(NopLogger),
+	)
+	defer client.Close()
+
+	if _, err := client.GenesisConfig(context.Background(), "shelley"); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	ctx, cancel := context.WithTimeout(
+		context.Background(),
+		100*time.Millisecond,
+	)
+	defer cancel()
+
+	if _, err := client.GenesisConfig(ctx, "slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v; want context.DeadlineExceeded", err)
+	}
+
+	// the connection remains usable after a canceled request
+	if _, err := client.GenesisConfig(context.Background(), "shelley"); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := atomic.LoadInt64(&connections), int64(1); got != want {
+		t.Fatalf("got %v connections; want %v", got, want)
+	}
+}
+
+// rpcHandler answers each JSON-RPC request with the result, or error when
+// result is nil, returned by fn for the request's method and params
+func rpcHandler(
+	connections *int64,
+	fn func(method string, params json.RawMessage) (result interface{}, err Map),
+) http.HandlerFunc {
+	var upgrader = websocket.Upgrader{}
+	return func(w http.ResponseWriter, req *http.Request) {
+		c, err := upgrader.Upgrade(w, req, nil)
+		if err != nil {
+			log.Print("upgrade:", err)
+			return
+		}
+		//nolint:errcheck
+		defer c.Close()
+		atomic.AddInt64(connections, 1)
+
+		for {
+			var request struct {
+				Method string
+				Params json.RawMessage
+				ID     json.RawMessage
+			}
+			if err := c.ReadJSON(&request); err != nil {
+				return
+			}
+
+			response := Map{
+				"jsonrpc": "2.0",
+				"method":  request.Method,
+				"id":      request.ID,
+			}
+			if result, e := fn(request.Method, request.Params); e != nil {
+				response["error"] = e
+			} else {
+				response["result"] = result
+			}
+			if err := c.WriteJSON(response); err != nil {
+				return
+			}
+		}
+	}
+}